@@ -46,10 +46,7 @@ func main() {
 		},
 	}
 
-	requestSize := &analyzer.RequestSize{
-		AvgInputTokens:  avgInputTokens,
-		AvgOutputTokens: avgOutputTokens,
-	}
+	requestSize := analyzer.NewRequestSize(avgInputTokens, avgOutputTokens)
 
 	targetPerf := &analyzer.TargetPerf{
 		TargetTTFT: targetTTFT,
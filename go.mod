@@ -1,5 +1,3 @@
 module github.com/atantawi/llm-queue-model
 
 go 1.23.0
-
-require github.com/llm-inferno/queue-analysis v0.1.0
@@ -0,0 +1,88 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/atantawi/llm-queue-model/pkg/queue"
+)
+
+// evaluate performance metrics of a closed loop of clients (e.g. a load generator in concurrency mode), each client
+// sending a request, waiting for its response, and thinking for an average think time (msec, zero for back-to-back
+// requests), rather than requests arriving at a given rate
+//   - clients are split evenly among replicas (some replicas with one more client if not divisible), the model of a
+//     replica is a finite population model with the service rates of the analyzer as a function of batch size
+//   - a client arriving at a full replica (max batch and queue sizes) is rejected and thinks again, OfferedRate counts
+//     all arrivals and DropRate rejected ones
+//   - percentiles of response time and the standard deviation of throughput are not evaluated (zero), nor are the
+//     variability of arrivals and service times, and limited prefill concurrency
+//   - the model of the analyzer is left unchanged
+func (qa *QueueAnalyzer) AnalyzeClosed(clients int, thinkTime float32) (*AnalysisMetrics, error) {
+	if clients <= 0 || thinkTime < 0 {
+		return nil, fmt.Errorf("invalid number of clients %d or think time %v", clients, thinkTime)
+	}
+	perReplica := clients / qa.Replicas
+	occupancyBound := qa.MaxBatchSize + qa.MaxQueueSize
+	if qa.Unbounded {
+		occupancyBound = perReplica + 1
+	}
+	model := queue.NewClosedModelStateDependent(occupancyBound, qa.Model.GetServiceRates())
+
+	// replicas with perReplica + 1 clients, then the rest with perReplica clients (none if fewer clients than replicas)
+	var offeredRate, throughput, respTime, waitTime, servTime, numInServ, queueLength float64
+	weights := make([]float64, qa.MaxBatchSize+1)
+	for _, group := range [][2]int{{perReplica + 1, clients % qa.Replicas}, {perReplica, qa.Replicas - clients%qa.Replicas}} {
+		n, replicas := group[0], float64(group[1])
+		if n == 0 || replicas == 0 {
+			continue
+		}
+		if _, err := model.SolveChecked(n, thinkTime); err != nil {
+			return nil, fmt.Errorf("invalid closed model %s: %w", model, err)
+		}
+		x := float64(model.GetThroughput()) * replicas
+		offeredRate += float64(model.GetOfferedRate()) * replicas
+		throughput += x
+		respTime += float64(model.GetAvgRespTime()) * x
+		waitTime += float64(model.GetAvgWaitTime()) * x
+		servTime += float64(model.GetAvgServTime()) * x
+		numInServ += float64(model.GetAvgNumInServers()) * replicas
+		queueLength += float64(model.GetAvgQueueLength()) * replicas
+		for b, w := range qa.batchTokenWeights(model.GetStateProbabilities(), model.GetProbBatchFull()) {
+			weights[b] += w * replicas
+		}
+	}
+
+	// times averaged over requests (weighted by throughput), occupancy over replicas
+	avgServTime := float32(servTime / throughput)
+	avgWaitTime := float32(waitTime / throughput)
+	effConc, err := EffectiveConcurrency(avgServTime, qa.timing(), qa.RequestSize, qa.MaxBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	prefillTime := qa.timing().PrefillTime(qa.RequestSize.AvgInputTokens, effConc)
+	avgNumInServ := float32(numInServ / float64(qa.Replicas))
+	rho := min(max(avgNumInServ/float32(qa.MaxBatchSize), 0), 1)
+	throughputPerSec := float32(throughput) * queue.MsecPerSecond
+	offeredPerSec := float32(offeredRate) * queue.MsecPerSecond
+	metrics := &AnalysisMetrics{
+		OfferedRate:    offeredPerSec,
+		Throughput:     throughputPerSec,
+		Goodput:        throughputPerSec,
+		DropRate:       max(offeredPerSec-throughputPerSec, 0),
+		PBlock:         float32(max(1-throughput/offeredRate, 0)),
+		AvgRespTime:    float32(respTime / throughput),
+		AvgWaitTime:    avgWaitTime,
+		AvgNumInServ:   avgNumInServ,
+		AvgQueueLength: float32(queueLength / float64(qa.Replicas)),
+		EffConc:        effConc,
+		AvgPrefillTime: prefillTime,
+		AvgTTFT:        timeToFirstToken(avgWaitTime, prefillTime),
+		AvgTokenTime:   qa.tokenTime(effConc),
+		P95TokenTime:   qa.tokenTimePercentile(weights, 0.95),
+		P99TokenTime:   qa.tokenTimePercentile(weights, 0.99),
+		MaxRate:        qa.RateRange.Max,
+		Rho:            rho,
+		Regime:         qa.Options.regime(rho, throughputPerSec/qa.RateRange.Max),
+	}
+	qa.setCost(metrics)
+	return metrics, nil
+}
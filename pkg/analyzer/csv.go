@@ -0,0 +1,45 @@
+package analyzer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// header of CSV columns, request rate followed by analysis metrics
+var csvHeader = []string{"Rate", "OfferedRate", "Throughput", "ThroughputStdDev", "Goodput", "DropRate", "PBlock", "AvgRespTime", "AvgWaitTime",
+	"P95RespTime", "P99RespTime", "AvgNumInServ", "AvgQueueLength", "EffConc", "AvgPrefillTime", "AvgTTFT", "AvgTokenTime",
+	"P95TokenTime", "P99TokenTime", "MaxRate", "Rho", "Regime", "Idle", "CostPerRequest", "CostPerMillionTokens"}
+
+// write analysis metrics at request rates (e.g. results of AnalyzeSweep) as CSV,
+// a header row followed by one row per rate with all metrics
+func WriteCSV(w io.Writer, rates []float32, metricsList []*AnalysisMetrics) error {
+	if len(rates) == 0 {
+		return fmt.Errorf("no rates to write")
+	}
+	if len(rates) != len(metricsList) {
+		return fmt.Errorf("mismatched number of rates %d and metrics %d", len(rates), len(metricsList))
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	f := func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	for i, m := range metricsList {
+		if m == nil {
+			return fmt.Errorf("missing metrics at rate %v", rates[i])
+		}
+		row := []string{f(rates[i]), f(m.OfferedRate), f(m.Throughput), f(m.ThroughputStdDev), f(m.Goodput), f(m.DropRate), f(m.PBlock),
+			f(m.AvgRespTime), f(m.AvgWaitTime), f(m.P95RespTime), f(m.P99RespTime), f(m.AvgNumInServ), f(m.AvgQueueLength), f(m.EffConc),
+			f(m.AvgPrefillTime), f(m.AvgTTFT), f(m.AvgTokenTime), f(m.P95TokenTime), f(m.P99TokenTime), f(m.MaxRate), f(m.Rho),
+			string(m.Regime), strconv.FormatBool(m.Idle), f(m.CostPerRequest), f(m.CostPerMillionTokens)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,116 @@
+package analyzer
+
+import "fmt"
+
+// create a new analyzer of a prefill/decode disaggregated deployment
+//   - prefill stage requests have the input tokens and a single output token
+//   - decode stage requests have no input tokens and the output tokens (first token generated by prefill stage)
+func NewDisaggregatedAnalyzer(config *DisaggregatedConfiguration, requestSize *RequestSize) (*DisaggregatedAnalyzer, error) {
+	prefillConfig, decodeConfig, err := config.stages()
+	if err != nil {
+		return nil, err
+	}
+	if err := requestSize.check(); err != nil {
+		return nil, err
+	}
+	if requestSize.AvgInputTokens <= 0 || requestSize.AvgOutputTokens <= 1 {
+		return nil, fmt.Errorf("disaggregated deployment needs input tokens and more than one output token, request size %s", requestSize)
+	}
+
+	prefillStage, err := NewQueueAnalyzer(prefillConfig, stageRequestSize(requestSize, true))
+	if err != nil {
+		return nil, fmt.Errorf("prefill stage: %v", err)
+	}
+	decodeStage, err := NewQueueAnalyzer(decodeConfig, stageRequestSize(requestSize, false))
+	if err != nil {
+		return nil, fmt.Errorf("decode stage: %v", err)
+	}
+
+	return &DisaggregatedAnalyzer{
+		PrefillStage: prefillStage,
+		DecodeStage:  decodeStage,
+		RequestSize:  requestSize,
+		RateRange: &RateRange{
+			Min: max(prefillStage.RateRange.Min, decodeStage.RateRange.Min),
+			Max: min(prefillStage.RateRange.Max, decodeStage.RateRange.Max),
+		},
+	}, nil
+}
+
+// configurations of the prefill and decode stages, each with the prefill parameters of the prefill stage and the
+// decode parameters of the decode stage, error if either is missing
+//   - prefill stage: prefill parameters, no chunking (decode parameters unused with a single output token)
+//   - decode stage: decode parameters (prefill parameters unused without input tokens)
+func (c *DisaggregatedConfiguration) stages() (prefillConfig *Configuration, decodeConfig *Configuration, err error) {
+	if c == nil || c.Prefill == nil || c.Decode == nil ||
+		c.Prefill.ServiceParms == nil || c.Decode.ServiceParms == nil ||
+		c.Prefill.ServiceParms.Prefill == nil && c.Prefill.ServiceParms.PrefillModel == nil ||
+		c.Decode.ServiceParms.Decode == nil && c.Decode.ServiceParms.DecodeModel == nil {
+		return nil, nil, fmt.Errorf("invalid disaggregated configuration %s", c)
+	}
+	var prefill *PrefillParms
+	if p := c.Prefill.ServiceParms.Prefill; p != nil {
+		unchunked := *p
+		unchunked.ChunkSize = 0
+		prefill = &unchunked
+	}
+	decodeParms := c.Decode.ServiceParms
+	prefillStage := *c.Prefill
+	prefillStage.ServiceParms = &ServiceParms{
+		Prefill:      prefill,
+		Decode:       decodeParms.Decode,
+		PrefillModel: c.Prefill.ServiceParms.PrefillModel,
+		DecodeModel:  decodeParms.DecodeModel,
+	}
+	decodeStage := *c.Decode
+	decodeStage.ServiceParms = &ServiceParms{
+		Prefill:      prefill,
+		Decode:       decodeParms.Decode,
+		Speculative:  decodeParms.Speculative,
+		PrefillModel: c.Prefill.ServiceParms.PrefillModel,
+		DecodeModel:  decodeParms.DecodeModel,
+	}
+	return &prefillStage, &decodeStage, nil
+}
+
+// request size seen by a stage, input tokens and first output token at prefill, remaining output tokens at decode
+func stageRequestSize(requestSize *RequestSize, isPrefill bool) *RequestSize {
+	stage := &RequestSize{AvgInputTokens: requestSize.AvgInputTokens, AvgOutputTokens: 1}
+	if !isPrefill {
+		stage = &RequestSize{AvgInputTokens: 0, AvgOutputTokens: requestSize.AvgOutputTokens}
+	}
+	for _, b := range requestSize.Distribution {
+		bucket := &SizeBucket{InputTokens: b.InputTokens, OutputTokens: 1, Weight: b.Weight}
+		if !isPrefill {
+			bucket = &SizeBucket{InputTokens: 0, OutputTokens: b.OutputTokens, Weight: b.Weight}
+		}
+		stage.Distribution = append(stage.Distribution, bucket)
+	}
+	return stage
+}
+
+// evaluate performance metrics given request rate
+//   - departures of the prefill stage are taken as (Poisson) arrivals to the decode stage
+func (da *DisaggregatedAnalyzer) Analyze(requestRate float32) (metrics *DisaggregatedMetrics, err error) {
+	if requestRate <= 0 || requestRate > da.RateRange.Max {
+		return nil, fmt.Errorf("invalid request rate %v, allowed range=%s", requestRate, da.RateRange)
+	}
+	prefillMetrics, err := da.PrefillStage.Analyze(requestRate)
+	if err != nil {
+		return nil, fmt.Errorf("prefill stage: %v", err)
+	}
+	decodeMetrics, err := da.DecodeStage.Analyze(prefillMetrics.Throughput)
+	if err != nil {
+		return nil, fmt.Errorf("decode stage: %v", err)
+	}
+	return &DisaggregatedMetrics{
+		OfferedRate:  requestRate,
+		Throughput:   decodeMetrics.Throughput,
+		AvgRespTime:  prefillMetrics.AvgRespTime + decodeMetrics.AvgRespTime,
+		AvgTTFT:      prefillMetrics.AvgTTFT,
+		AvgTokenTime: decodeMetrics.AvgTokenTime,
+		MaxRate:      da.RateRange.Max,
+		Prefill:      prefillMetrics,
+		Decode:       decodeMetrics,
+	}, nil
+}
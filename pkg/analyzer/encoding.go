@@ -0,0 +1,119 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/atantawi/llm-queue-model/pkg/queue"
+)
+
+// version of the encoding of an analyzer (MarshalBinary), changed with the encoded state
+const analyzerStateVersion = 1
+
+// encoded state of an analyzer, the model encoded by its own MarshalBinary
+type analyzerState struct {
+	Version               int
+	MaxBatchSize          int
+	ConfigMaxBatchSize    int
+	FractionalMaxBatch    float32
+	KVCache               *KVCacheParms
+	MaxQueueSize          int
+	LossOnly              bool
+	MaxPrefillConcurrency int
+	MaxPrefillBatch       int
+	MaxDecodeBatch        int
+	Unbounded             bool
+	Replicas              int
+	CostPerSecond         float32
+	ServiceParms          *ServiceParms
+	RequestSize           *RequestSize
+	Options               *AnalyzerOptions
+	ServiceSCV            float32
+	ArrivalSCV            float32
+	Model                 *queue.MM1ModelStateDependent
+	RateRange             *RateRange
+}
+
+// encode the analyzer, including the solved state of its model (e.g. to precompute analyzers offline and restore them
+// at serve time), as a versioned gob
+//   - service parameters with plugged-in timing models (PrefillModel, DecodeModel) cannot be encoded
+//   - the moments of service time of a mix of request classes (MultiClassAnalyzer) are not encoded, a restored analyzer
+//     recalculates moments (e.g. in sensitivity analysis) for a single class of the average request size
+func (qa *QueueAnalyzer) MarshalBinary() ([]byte, error) {
+	if err := qa.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to encode analyzer: %w", err)
+	}
+	if qa.ServiceParms.pluggable() {
+		return nil, fmt.Errorf("failed to encode analyzer: plugged-in timing models cannot be encoded")
+	}
+	state := analyzerState{
+		Version:               analyzerStateVersion,
+		MaxBatchSize:          qa.MaxBatchSize,
+		ConfigMaxBatchSize:    qa.ConfigMaxBatchSize,
+		FractionalMaxBatch:    qa.FractionalMaxBatch,
+		KVCache:               qa.KVCache,
+		MaxQueueSize:          qa.MaxQueueSize,
+		LossOnly:              qa.LossOnly,
+		MaxPrefillConcurrency: qa.MaxPrefillConcurrency,
+		MaxPrefillBatch:       qa.MaxPrefillBatch,
+		MaxDecodeBatch:        qa.MaxDecodeBatch,
+		Unbounded:             qa.Unbounded,
+		Replicas:              qa.Replicas,
+		CostPerSecond:         qa.CostPerSecond,
+		ServiceParms:          qa.ServiceParms,
+		RequestSize:           qa.RequestSize,
+		Options:               qa.Options,
+		ServiceSCV:            qa.ServiceSCV,
+		ArrivalSCV:            qa.ArrivalSCV,
+		Model:                 qa.Model,
+		RateRange:             qa.RateRange,
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&state); err != nil {
+		return nil, fmt.Errorf("failed to encode analyzer: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// decode an analyzer encoded by MarshalBinary, replacing the analyzer
+//   - the version is checked, and the restored analyzer validated (Validate), including the service rates and
+//     occupancy bound of the model against the configuration; the analyzer is left unchanged if invalid
+func (qa *QueueAnalyzer) UnmarshalBinary(data []byte) error {
+	var state analyzerState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return fmt.Errorf("failed to decode analyzer: %w", err)
+	}
+	if state.Version != analyzerStateVersion {
+		return fmt.Errorf("unsupported analyzer version %d, expected %d", state.Version, analyzerStateVersion)
+	}
+	restored := &QueueAnalyzer{
+		MaxBatchSize:          state.MaxBatchSize,
+		ConfigMaxBatchSize:    state.ConfigMaxBatchSize,
+		FractionalMaxBatch:    state.FractionalMaxBatch,
+		KVCache:               state.KVCache,
+		MaxQueueSize:          state.MaxQueueSize,
+		LossOnly:              state.LossOnly,
+		MaxPrefillConcurrency: state.MaxPrefillConcurrency,
+		MaxPrefillBatch:       state.MaxPrefillBatch,
+		MaxDecodeBatch:        state.MaxDecodeBatch,
+		Unbounded:             state.Unbounded,
+		Replicas:              state.Replicas,
+		CostPerSecond:         state.CostPerSecond,
+		ServiceParms:          state.ServiceParms,
+		RequestSize:           state.RequestSize,
+		Options:               state.Options,
+		ServiceSCV:            state.ServiceSCV,
+		ArrivalSCV:            state.ArrivalSCV,
+		Model:                 state.Model,
+		RateRange:             state.RateRange,
+	}
+	if err := restored.Validate(); err != nil {
+		return fmt.Errorf("invalid decoded analyzer: %w", err)
+	}
+	if n := len(restored.Model.GetServiceRates()); n != restored.MaxBatchSize {
+		return fmt.Errorf("invalid decoded analyzer: model has %d service rates, expected max batch size %d", n, restored.MaxBatchSize)
+	}
+	*qa = *restored
+	return nil
+}
@@ -0,0 +1,78 @@
+package analyzer
+
+import "fmt"
+
+// fit prefill parameters to measured samples using least-squares linear regression, returns
+//   - prefill parameters: prefill time = gamma + delta * inputTokens * batchSize
+//   - coefficient of determination (R-squared) of the fit
+func FitPrefillParms(samples []PrefillSample) (parms *PrefillParms, rSquared float32, err error) {
+	x := make([]float64, len(samples))
+	y := make([]float64, len(samples))
+	for i, s := range samples {
+		x[i] = float64(s.InputTokens) * float64(s.BatchSize)
+		y[i] = float64(s.PrefillTime)
+	}
+	intercept, slope, r2, err := linearFit(x, y)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fit prefill parameters: %v", err)
+	}
+	return &PrefillParms{Gamma: float32(intercept), Delta: float32(slope)}, float32(r2), nil
+}
+
+// fit decode parameters to measured samples using least-squares linear regression, returns
+//   - decode parameters: decode time = alpha + beta * batchSize
+//   - coefficient of determination (R-squared) of the fit
+func FitDecodeParms(samples []DecodeSample) (parms *DecodeParms, rSquared float32, err error) {
+	x := make([]float64, len(samples))
+	y := make([]float64, len(samples))
+	for i, s := range samples {
+		x[i] = float64(s.BatchSize)
+		y[i] = float64(s.DecodeTime)
+	}
+	intercept, slope, r2, err := linearFit(x, y)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fit decode parameters: %v", err)
+	}
+	return &DecodeParms{Alpha: float32(intercept), Beta: float32(slope)}, float32(r2), nil
+}
+
+// simple linear regression y = intercept + slope * x, returns intercept, slope, and R-squared
+func linearFit(x []float64, y []float64) (intercept float64, slope float64, r2 float64, err error) {
+	n := len(x)
+	if n < 2 {
+		return 0, 0, 0, fmt.Errorf("at least two samples needed, have %d", n)
+	}
+	var meanX, meanY float64
+	for i := range n {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var sxx, sxy, syy float64
+	for i := range n {
+		dx := x[i] - meanX
+		dy := y[i] - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, 0, 0, fmt.Errorf("samples do not vary in the independent variable")
+	}
+	slope = sxy / sxx
+	intercept = meanY - slope*meanX
+
+	// R-squared = 1 - residual sum of squares / total sum of squares
+	var ssRes float64
+	for i := range n {
+		e := y[i] - (intercept + slope*x[i])
+		ssRes += e * e
+	}
+	r2 = 1
+	if syy > 0 {
+		r2 = 1 - ssRes/syy
+	}
+	return intercept, slope, r2, nil
+}
@@ -0,0 +1,100 @@
+package analyzer
+
+import "fmt"
+
+// create a new analyzer of a mix of request classes sharing the same server
+//   - the queueing model is built from the mixture of the service times of the classes, weighted by arrival fractions
+//   - arrival fractions are normalized to sum to one
+func NewMultiClassAnalyzer(qConfig *Configuration, classes []*WorkloadClass) (*MultiClassAnalyzer, error) {
+	if err := qConfig.check(); err != nil {
+		return nil, err
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("no request classes")
+	}
+	var sumFractions float32
+	for _, c := range classes {
+		if err := c.check(); err != nil {
+			return nil, err
+		}
+		sumFractions += c.ArrivalFraction
+	}
+
+	// normalize arrival fractions and average request size over classes
+	normalized := make([]*WorkloadClass, len(classes))
+	requestSize := &RequestSize{}
+	for i, c := range classes {
+		fraction := c.ArrivalFraction / sumFractions
+		normalized[i] = &WorkloadClass{
+			Name:            c.Name,
+			RequestSize:     c.RequestSize.clone(),
+			ArrivalFraction: fraction,
+		}
+		requestSize.AvgInputTokens += fraction * c.RequestSize.AvgInputTokens
+		requestSize.AvgOutputTokens += fraction * c.RequestSize.AvgOutputTokens
+	}
+
+	moments := multiClassMoments(qConfig.timing(), normalized)
+	if err := checkModel(qConfig, requestSize, moments); err != nil {
+		return nil, err
+	}
+	qa := buildModel(qConfig, requestSize, moments)
+	qa.classes = normalized
+	return &MultiClassAnalyzer{
+		QueueAnalyzer: qa,
+		Classes:       normalized,
+	}, nil
+}
+
+// moments of request service time of a mix of request classes as a function of batch size
+//   - service time is a mixture over the classes of the service times of the classes
+func multiClassMoments(parms *ServiceParms, classes []*WorkloadClass) func(batchSize float32) (mean float32, scv float32) {
+	return func(batchSize float32) (float32, float32) {
+		var first, second float64
+		for _, c := range classes {
+			m, v := ServiceTimeMoments(parms, c.RequestSize, batchSize)
+			w := float64(c.ArrivalFraction)
+			first += w * float64(m)
+			second += w * (1 + float64(v)) * float64(m) * float64(m)
+		}
+		return float32(first), float32(second/(first*first) - 1)
+	}
+}
+
+// evaluate performance metrics of the combined workload and of each class given (total) request rate
+//   - all classes see the same waiting time and batch size
+//   - admitted requests of a class are in proportion to its arrival fraction
+//   - classes with prefill see the same wait for a prefill slot, if prefill concurrency is limited
+func (mqa *MultiClassAnalyzer) AnalyzeClasses(requestRate float32) (metrics *MultiClassMetrics, err error) {
+	aggregate, err := mqa.Analyze(requestRate)
+	if err != nil {
+		return nil, err
+	}
+	effConc := aggregate.EffConc
+	timing := mqa.timing()
+	prefillWaitTime, err := mqa.prefillWaitTime(timing.PrefillTime(mqa.RequestSize.AvgInputTokens, effConc))
+	if err != nil {
+		return nil, err
+	}
+	classMetrics := make([]*ClassMetrics, len(mqa.Classes))
+	for i, c := range mqa.Classes {
+		prefillTime := timing.PrefillTime(c.RequestSize.AvgInputTokens, effConc)
+		servTime, _ := ServiceTimeMoments(timing, c.RequestSize, effConc)
+		if c.RequestSize.AvgInputTokens > 0 {
+			prefillTime += prefillWaitTime
+			servTime += prefillWaitTime
+		}
+		classMetrics[i] = &ClassMetrics{
+			Name:           c.Name,
+			Throughput:     aggregate.Throughput * c.ArrivalFraction,
+			AvgRespTime:    aggregate.AvgWaitTime + servTime,
+			AvgPrefillTime: prefillTime,
+			TTFT:           timeToFirstToken(aggregate.AvgWaitTime, prefillTime),
+			ITL:            timing.TokenTime(effConc, c.RequestSize.AvgOutputTokens),
+		}
+	}
+	return &MultiClassMetrics{
+		Aggregate: aggregate,
+		Classes:   classMetrics,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import "math"
+
+// set the fraction of maximum throughput kept as a margin for target TPS
+func WithStabilityFraction(fraction float32) Option {
+	return func(c *Configuration) {
+		c.Options.StabilitySafetyFraction = fraction
+	}
+}
+
+// set the small disturbance setting the range of request rates
+func WithEpsilon(epsilon float32) Option {
+	return func(c *Configuration) {
+		c.Options.Epsilon = epsilon
+	}
+}
+
+// set separate margins of the range of request rates, a lower one setting the min rate as a fraction of the service
+// rate at batch size 1 (e.g. larger to avoid degenerate near-zero solves), and an upper one cut from the max service
+// rate (e.g. tuned for how close to saturation the model is solved), zero for epsilon
+func WithRateMargins(lower float32, upper float32) Option {
+	return func(c *Configuration) {
+		c.Options.LowerMargin = lower
+		c.Options.UpperMargin = upper
+	}
+}
+
+// set the largest max batch size accepted in the configuration
+func WithMaxBatchSizeLimit(limit int) Option {
+	return func(c *Configuration) {
+		c.Options.MaxBatchSizeLimit = limit
+	}
+}
+
+// set the largest max queue size accepted in the configuration
+func WithMaxQueueSizeLimit(limit int) Option {
+	return func(c *Configuration) {
+		c.Options.MaxQueueSizeLimit = limit
+	}
+}
+
+// solve the model as a linear system of balance equations rather than by the (lighter, rescaled) recurrence
+func WithLinearSolver() Option {
+	return func(c *Configuration) {
+		c.Options.LinearSolver = true
+	}
+}
+
+// set the thresholds of load between regimes (underloaded, healthy, near saturation, saturated), increasing in [0, 1]
+func WithRegimeThresholds(underloaded float32, nearSaturation float32, saturated float32) Option {
+	return func(c *Configuration) {
+		c.Options.UnderloadedLoad = underloaded
+		c.Options.NearSaturationLoad = nearSaturation
+		c.Options.SaturatedLoad = saturated
+	}
+}
+
+// set ceilings on the batch sizes of the prefill and decode stages (zero if not limited), e.g. an engine decoding
+// a larger batch than it prefills
+func WithStageBatchCeilings(maxPrefillBatch int, maxDecodeBatch int) Option {
+	return func(c *Configuration) {
+		c.MaxPrefillBatch = maxPrefillBatch
+		c.MaxDecodeBatch = maxDecodeBatch
+	}
+}
+
+// set a fractional max batch size (e.g. a measured average batch ceiling), with the max batch size its value rounded up
+func WithFractionalMaxBatch(maxBatch float32) Option {
+	return func(c *Configuration) {
+		c.FractionalMaxBatch = maxBatch
+		c.MaxBatchSize = int(math.Ceil(float64(maxBatch)))
+	}
+}
+
+// set the number of identical replicas sharing the load evenly
+func WithReplicas(replicas int) Option {
+	return func(c *Configuration) {
+		c.Replicas = replicas
+	}
+}
+
+// set the cost of running a replica per second
+func WithCostPerSecond(cost float32) Option {
+	return func(c *Configuration) {
+		c.CostPerSecond = cost
+	}
+}
+
+// set the squared coefficient of variation of interarrival time (burstiness of traffic, one for Poisson arrivals)
+func WithArrivalSCV(scv float32) Option {
+	return func(c *Configuration) {
+		c.ArrivalSCV = scv
+	}
+}
+
+// reject requests when all batch slots are busy rather than queue them
+func WithLossOnly() Option {
+	return func(c *Configuration) {
+		c.LossOnly = true
+	}
+}
+
+// queue requests without limit
+func WithUnboundedQueue() Option {
+	return func(c *Configuration) {
+		c.Unbounded = true
+	}
+}
+
+// copy of configuration modified by options, with analyzer options set (defaults if nil)
+func (c *Configuration) withOptions(opts []Option) *Configuration {
+	config := *c
+	options := DefaultAnalyzerOptions()
+	if c.Options != nil {
+		*options = *c.Options
+	}
+	config.Options = options
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &config
+}
@@ -0,0 +1,208 @@
+package prom
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atantawi/llm-queue-model/pkg/analyzer"
+)
+
+// content type of the Prometheus text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// gauge derived from analysis metrics
+type gauge struct {
+	name  string
+	help  string
+	value func(*analyzer.AnalysisMetrics) float32
+}
+
+// gauges exported for each set of label values
+var gauges = []gauge{
+	{"offered_rate_requests_per_second", "Offered request rate.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.OfferedRate }},
+	{"throughput_requests_per_second", "Effective (admitted) throughput.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.Throughput }},
+	{"throughput_stddev_requests_per_second", "Standard deviation of throughput.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.ThroughputStdDev }},
+	{"goodput_requests_per_second", "Throughput of requests meeting performance targets.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.Goodput }},
+	{"drop_rate_requests_per_second", "Rate of requests rejected due to a full system.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.DropRate }},
+	{"blocking_probability", "Probability that an arriving request is rejected.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.PBlock }},
+	{"avg_resp_time_milliseconds", "Average request response time.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgRespTime }},
+	{"avg_wait_time_milliseconds", "Average request queueing time.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgWaitTime }},
+	{"p95_resp_time_milliseconds", "95th percentile of request response time.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.P95RespTime }},
+	{"p99_resp_time_milliseconds", "99th percentile of request response time.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.P99RespTime }},
+	{"avg_prefill_time_milliseconds", "Average request prefill time.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgPrefillTime }},
+	{"avg_ttft_milliseconds", "Average time to first token (queueing and prefill).",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgTTFT }},
+	{"avg_token_time_milliseconds", "Average token decode time.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgTokenTime }},
+	{"p95_token_time_milliseconds", "95th percentile of token decode time over tokens.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.P95TokenTime }},
+	{"p99_token_time_milliseconds", "99th percentile of token decode time over tokens.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.P99TokenTime }},
+	{"avg_num_in_service", "Average number of requests in service (per replica).",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgNumInServ }},
+	{"avg_queue_length", "Average number of requests waiting in queue (per replica).",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.AvgQueueLength }},
+	{"effective_concurrency", "Effective concurrency, batch size consistent with average service time (per replica).",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.EffConc }},
+	{"max_rate_requests_per_second", "Maximum throughput.",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.MaxRate }},
+	{"utilization", "Utilization (per replica).",
+		func(m *analyzer.AnalysisMetrics) float32 { return m.Rho }},
+	{"idle", "Request rate below the min rate, metrics of the idle baseline (1 if idle, 0 otherwise).",
+		func(m *analyzer.AnalysisMetrics) float32 {
+			if m.Idle {
+				return 1
+			}
+			return 0
+		}},
+}
+
+// operating regimes, exported as a state set: one series per regime, labeled by regime, one for the current regime
+// and zero for the others
+var regimes = []analyzer.Regime{analyzer.RegimeUnderloaded, analyzer.RegimeHealthy, analyzer.RegimeNearSaturation,
+	analyzer.RegimeSaturated}
+
+// name of the label of the regime state set
+const regimeLabel = "regime"
+
+// Exporter of analysis metrics as Prometheus gauges, served in the text exposition format
+//   - one series per gauge for each set of label values (e.g. model name, namespace),
+//     so that metrics of multiple analyzers coexist
+//   - the regime state set adds a label named regime to the label names, which should not include it
+//   - safe for concurrent use
+type Exporter struct {
+	namespace  string                               // prefix of gauge names
+	labelNames []string                             // names of labels identifying an analyzer
+	mutex      sync.Mutex                           // guards metrics and labels
+	metrics    map[string]*analyzer.AnalysisMetrics // latest metrics keyed by label values
+	labels     map[string][]string                  // label values of each series, same keys as metrics
+}
+
+// create a new exporter, gauge names prefixed by namespace (may be empty)
+func NewExporter(namespace string, labelNames ...string) *Exporter {
+	names := make([]string, len(labelNames))
+	copy(names, labelNames)
+	return &Exporter{
+		namespace:  namespace,
+		labelNames: names,
+		metrics:    make(map[string]*analyzer.AnalysisMetrics),
+		labels:     make(map[string][]string),
+	}
+}
+
+// set gauges of given label values from analysis metrics
+func (e *Exporter) Update(metrics *analyzer.AnalysisMetrics, labelValues ...string) error {
+	if metrics == nil {
+		return fmt.Errorf("missing metrics")
+	}
+	if len(labelValues) != len(e.labelNames) {
+		return fmt.Errorf("expected %d label values %v, got %d", len(e.labelNames), e.labelNames, len(labelValues))
+	}
+	key := labelKey(labelValues)
+	values := make([]string, len(labelValues))
+	copy(values, labelValues)
+	m := *metrics
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.metrics[key] = &m
+	e.labels[key] = values
+	return nil
+}
+
+// remove gauges of given label values
+func (e *Exporter) Delete(labelValues ...string) {
+	key := labelKey(labelValues)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.metrics, key)
+	delete(e.labels, key)
+}
+
+// write gauges in the Prometheus text exposition format
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	e.mutex.Lock()
+	keys := make([]string, 0, len(e.metrics))
+	for key := range e.metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, g := range gauges {
+		name := e.name(g.name)
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, g.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s%s %v\n", name, formatLabels(e.labelNames, e.labels[key]), g.value(e.metrics[key]))
+		}
+	}
+	name := e.name(regimeLabel)
+	fmt.Fprintf(&b, "# HELP %s %s\n", name, "Operating regime, one for the current regime and zero for the others.")
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+	labelNames := append(slices.Clone(e.labelNames), regimeLabel)
+	for _, key := range keys {
+		for _, regime := range regimes {
+			var value int
+			if e.metrics[key].Regime == regime {
+				value = 1
+			}
+			labelValues := append(slices.Clone(e.labels[key]), string(regime))
+			fmt.Fprintf(&b, "%s%s %d\n", name, formatLabels(labelNames, labelValues), value)
+		}
+	}
+	e.mutex.Unlock()
+	return b.WriteTo(w)
+}
+
+// serve gauges to a Prometheus scrape
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	e.WriteTo(w)
+}
+
+// full name of gauge
+func (e *Exporter) name(gaugeName string) string {
+	if e.namespace == "" {
+		return gaugeName
+	}
+	return e.namespace + "_" + gaugeName
+}
+
+// label set of a series, e.g. {model="llama",namespace="default"}
+func formatLabels(labelNames []string, labelValues []string) string {
+	if len(labelNames) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labelNames))
+	for i, name := range labelNames {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escape(labelValues[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// key of a set of label values
+func labelKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// escape a label value: backslash, double quote, and line feed
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
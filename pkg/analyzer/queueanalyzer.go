@@ -1,108 +1,794 @@
 package analyzer
 
 import (
+	"context"
 	"fmt"
+	"math"
 
-	"github.com/llm-inferno/queue-analysis/pkg/queue"
+	"github.com/atantawi/llm-queue-model/pkg/queue"
 
-	utils "github.com/llm-inferno/queue-analysis/pkg/utils"
+	utils "github.com/atantawi/llm-queue-model/pkg/utils"
 )
 
 // create a new queue analyzer from config
 func NewQueueAnalyzer(qConfig *Configuration, requestSize *RequestSize) (*QueueAnalyzer, error) {
+	return NewQueueAnalyzerWithOptions(qConfig, requestSize)
+}
+
+// create a new queue analyzer from config, modified by options (config itself left unchanged)
+func NewQueueAnalyzerWithOptions(qConfig *Configuration, requestSize *RequestSize, opts ...Option) (*QueueAnalyzer, error) {
+	if qConfig == nil || requestSize == nil {
+		return nil, fmt.Errorf("missing configuration or request size")
+	}
+	if len(opts) > 0 {
+		qConfig = qConfig.withOptions(opts)
+	}
 	if err := qConfig.check(); err != nil {
 		return nil, err
 	}
 	if err := requestSize.check(); err != nil {
 		return nil, err
 	}
+	if err := checkModel(qConfig, requestSize, singleClassMoments(qConfig.timing(), requestSize)); err != nil {
+		return nil, err
+	}
 	// build queueing model
 	return BuildModel(qConfig, requestSize), nil
 }
 
 // build queueing model using service rates, leaving arrival rate as parameter
+//   - configuration and request size assumed checked (e.g. by NewQueueAnalyzer), rejecting an empty range of request rates
 func BuildModel(qConfig *Configuration, requestSize *RequestSize) (modelData *QueueAnalyzer) {
+	return buildModel(qConfig, requestSize, singleClassMoments(qConfig.timing(), requestSize))
+}
+
+// build queueing model given the moments of request service time as a function of batch size
+func buildModel(qConfig *Configuration, requestSize *RequestSize,
+	moments func(batchSize float32) (mean float32, scv float32)) *QueueAnalyzer {
+	configMaxBatchSize := qConfig.MaxBatchSize
+	qConfig, _ = qConfig.limitedBy(requestSize)
 	parms := qConfig.ServiceParms
+	options := qConfig.Options
+	if options == nil {
+		options = DefaultAnalyzerOptions()
+	}
 
 	// calculate state-dependent service rate
-	servRate := make([]float32, qConfig.MaxBatchSize)
-	for n := 1; n <= qConfig.MaxBatchSize; n++ {
-		prefillTime := parms.Prefill.PrefillTime(requestSize.AvgInputTokens, float32(n))
-		decodeTime := float32(requestSize.AvgOutputTokens-1) * parms.Decode.DecodeTime(float32(n))
-		servRate[n-1] = float32(n) / (prefillTime + decodeTime)
-	}
+	servRate, serviceSCV := serviceRates(qConfig, moments)
+
+	// load is split evenly among replicas
+	replicas := max(qConfig.Replicas, 1)
 
 	// set and check limits
-	lambdaMin := servRate[0] * Epsilon
-	lambdaMax := servRate[qConfig.MaxBatchSize-1] * (1 - Epsilon)
-	rateRange := &RateRange{Min: lambdaMin * 1000, Max: lambdaMax * 1000}
+	rateRange := rateBounds(servRate[0], servRate[qConfig.MaxBatchSize-1], prefillCapacity(qConfig, requestSize), replicas, options)
 
 	// create and solve model
-	occupancyUpperBound := qConfig.MaxQueueSize + qConfig.MaxBatchSize
-	model := queue.NewMM1ModelStateDependent(occupancyUpperBound, servRate)
+	maxQueueSize := qConfig.MaxQueueSize
+	if qConfig.LossOnly {
+		maxQueueSize = 0
+	}
+	var model *queue.MM1ModelStateDependent
+	if qConfig.Unbounded {
+		model = queue.NewMM1ModelStateDependentUnbounded(servRate)
+	} else {
+		occupancyUpperBound := maxQueueSize + qConfig.MaxBatchSize
+		model = queue.NewMM1ModelStateDependent(occupancyUpperBound, servRate)
+	}
+	model.SetLinearSolver(options.LinearSolver)
 	return &QueueAnalyzer{
-		MaxBatchSize: qConfig.MaxBatchSize,
-		MaxQueueSize: qConfig.MaxQueueSize,
-		ServiceParms: parms,
-		RequestSize:  requestSize,
-		Model:        model,
-		RateRange:    rateRange,
+		MaxBatchSize:          qConfig.MaxBatchSize,
+		ConfigMaxBatchSize:    configMaxBatchSize,
+		FractionalMaxBatch:    qConfig.FractionalMaxBatch,
+		KVCache:               qConfig.KVCache,
+		MaxQueueSize:          maxQueueSize,
+		LossOnly:              qConfig.LossOnly,
+		MaxPrefillConcurrency: qConfig.MaxPrefillConcurrency,
+		MaxPrefillBatch:       qConfig.MaxPrefillBatch,
+		MaxDecodeBatch:        qConfig.MaxDecodeBatch,
+		Unbounded:             qConfig.Unbounded,
+		Replicas:              replicas,
+		CostPerSecond:         qConfig.CostPerSecond,
+		ServiceParms:          parms,
+		RequestSize:           requestSize,
+		Options:               options,
+		ServiceSCV:            serviceSCV,
+		ArrivalSCV:            qConfig.ArrivalSCV,
+		Model:                 model,
+		RateRange:             rateRange,
 	}
 }
 
+// check that a model can be built from a configuration given request size and moments of request service time:
+// a request fits in the KV cache memory, if given, service rates are valid up to the max batch size, and the range
+// of request rates is not empty
+func checkModel(qConfig *Configuration, requestSize *RequestSize,
+	moments func(batchSize float32) (mean float32, scv float32)) error {
+	config, err := qConfig.limitedBy(requestSize)
+	if err != nil {
+		return err
+	}
+	servRate, _ := serviceRates(config, moments)
+	if err := checkServiceRates(servRate); err != nil {
+		return err
+	}
+	options := config.Options
+	if options == nil {
+		options = DefaultAnalyzerOptions()
+	}
+	minServRate, maxServRate := servRate[0], servRate[len(servRate)-1]
+	rateRange := rateBounds(minServRate, maxServRate, prefillCapacity(config, requestSize), max(config.Replicas, 1), options)
+	return checkRateRange(rateRange, minServRate, maxServRate)
+}
+
+// evaluate the range of request rates (requests/sec) of the model of a configuration and request size,
+// same as the rate range of the analyzer, without building and solving the model
+//   - only the service rates at batch sizes 1 and MaxBatchSize are calculated
+func RateBounds(qConfig *Configuration, requestSize *RequestSize) (*RateRange, error) {
+	if qConfig == nil || requestSize == nil {
+		return nil, fmt.Errorf("missing configuration or request size")
+	}
+	if err := qConfig.check(); err != nil {
+		return nil, err
+	}
+	if err := requestSize.check(); err != nil {
+		return nil, err
+	}
+	options := qConfig.Options
+	if options == nil {
+		options = DefaultAnalyzerOptions()
+	}
+	qConfig, err := qConfig.limitedBy(requestSize)
+	if err != nil {
+		return nil, err
+	}
+	moments := singleClassMoments(qConfig.timing(), requestSize)
+	batchSize := float32(qConfig.MaxBatchSize)
+	minServTime, _ := moments(1)
+	maxServTime, _ := moments(batchSize)
+	servRate := []float32{1 / minServTime, batchSize / maxServTime}
+	if w := qConfig.maxBatchWeight(); w < 1 {
+		belowServTime, _ := moments(batchSize - 1)
+		below := (batchSize - 1) / belowServTime
+		servRate[1] = below + w*(servRate[1]-below)
+	}
+	if err := checkServiceRates(servRate); err != nil {
+		return nil, err
+	}
+	rateRange := rateBounds(servRate[0], servRate[1], prefillCapacity(qConfig, requestSize), max(qConfig.Replicas, 1), options)
+	if err := checkRateRange(rateRange, servRate[0], servRate[1]); err != nil {
+		return nil, err
+	}
+	return rateRange, nil
+}
+
+// range of request rates (requests/sec) given service rates (requests/msec) of a replica at batch sizes 1 and max
+//   - from a small disturbance above zero, to slightly less than the max service rate of all replicas, by the lower
+//     and upper margins (epsilon unless set)
+//   - the max service rate is limited by the prefill capacity (requests/msec) of a replica, if given (positive)
+func rateBounds(minServRate float32, maxServRate float32, prefillRate float32, replicas int, options *AnalyzerOptions) *RateRange {
+	if prefillRate > 0 {
+		maxServRate = min(maxServRate, prefillRate)
+	}
+	lower, upper := options.margins()
+	lambdaMin := minServRate * lower
+	lambdaMax := maxServRate * (1 - upper) * float32(replicas)
+	return &RateRange{Min: lambdaMin * 1000, Max: lambdaMax * 1000}
+}
+
+// max rate (requests/msec) of prefills of a replica with limited prefill concurrency, all slots busy with the longest
+// prefill (at max batch size), zero if not limited (no limit, at least as many slots as max batch size, or no input tokens)
+func prefillCapacity(qConfig *Configuration, requestSize *RequestSize) float32 {
+	slots := qConfig.MaxPrefillConcurrency
+	if slots <= 0 || slots >= qConfig.MaxBatchSize || requestSize.AvgInputTokens == 0 {
+		return 0
+	}
+	return float32(slots) / qConfig.timing().PrefillTime(requestSize.AvgInputTokens, float32(qConfig.MaxBatchSize))
+}
+
+// calculate state-dependent service rates (requests/msec) for batch sizes 1, 2, ..., MaxBatchSize, returns
+//   - service rates, the one at max batch size interpolated linearly if the max batch size is fractional
+//   - squared coefficient of variation of request service time at max batch size
+func serviceRates(qConfig *Configuration, moments func(batchSize float32) (mean float32, scv float32)) (servRate []float32, serviceSCV float32) {
+	servRate = make([]float32, qConfig.MaxBatchSize)
+	for n := 1; n <= qConfig.MaxBatchSize; n++ {
+		var avgServTime float32
+		avgServTime, serviceSCV = moments(float32(n))
+		servRate[n-1] = float32(n) / avgServTime
+	}
+	if w, n := qConfig.maxBatchWeight(), qConfig.MaxBatchSize; w < 1 {
+		servRate[n-1] = servRate[n-2] + w*(servRate[n-1]-servRate[n-2])
+	}
+	return servRate, serviceSCV
+}
+
+// moments of request service time of a single class of requests as a function of batch size
+func singleClassMoments(parms *ServiceParms, requestSize *RequestSize) func(batchSize float32) (mean float32, scv float32) {
+	return func(batchSize float32) (float32, float32) {
+		return ServiceTimeMoments(parms, requestSize, batchSize)
+	}
+}
+
+// moments of request service time used to build the model, of the mix of request classes if any, otherwise of a single
+// class of the request size
+func (qa *QueueAnalyzer) serviceMoments() func(batchSize float32) (mean float32, scv float32) {
+	if qa.classes != nil {
+		return multiClassMoments(qa.configuration().timing(), qa.classes)
+	}
+	return singleClassMoments(qa.configuration().timing(), qa.RequestSize)
+}
+
+// check all invariants of an analyzer, returning the first violation,
+// e.g. before using an analyzer assembled directly rather than created by NewQueueAnalyzer
+func (qa *QueueAnalyzer) Validate() error {
+	if qa.ServiceParms == nil || qa.RequestSize == nil || qa.Options == nil || qa.Model == nil || qa.RateRange == nil {
+		return fmt.Errorf("incomplete analyzer, missing service parameters, request size, options, model, or rate range")
+	}
+	config := qa.configuration()
+	if err := config.check(); err != nil {
+		return err
+	}
+	if qa.Replicas < 1 {
+		return fmt.Errorf("invalid number of replicas %d, should be at least one", qa.Replicas)
+	}
+	if qa.LossOnly && qa.MaxQueueSize != 0 {
+		return fmt.Errorf("invalid max queue size %d of loss-only analyzer, should be zero", qa.MaxQueueSize)
+	}
+	if err := qa.RequestSize.check(); err != nil {
+		return err
+	}
+	if err := checkModel(config, qa.RequestSize, qa.serviceMoments()); err != nil {
+		return err
+	}
+	if limited, _ := config.limitedBy(qa.RequestSize); qa.MaxBatchSize != limited.MaxBatchSize {
+		return fmt.Errorf("max batch size %d inconsistent with configured %d limited by KV cache memory to %d",
+			qa.MaxBatchSize, config.MaxBatchSize, limited.MaxBatchSize)
+	}
+	occupancyUpperBound := qa.MaxBatchSize + qa.MaxQueueSize
+	if qa.Unbounded {
+		occupancyUpperBound = qa.MaxBatchSize
+	}
+	if qa.Model.IsUnbounded() != qa.Unbounded || qa.Model.K != occupancyUpperBound {
+		return fmt.Errorf("model occupancy bound %d (unbounded=%v) inconsistent with maxBatch=%d, maxQueue=%d (unbounded=%v)",
+			qa.Model.K, qa.Model.IsUnbounded(), qa.MaxBatchSize, qa.MaxQueueSize, qa.Unbounded)
+	}
+	if qa.RateRange.Min <= 0 || !(qa.RateRange.Min < qa.RateRange.Max) {
+		return fmt.Errorf("invalid rate range %s", qa.RateRange)
+	}
+	return nil
+}
+
 // evaluate performance metrics given request rate
-func (qa *QueueAnalyzer) Analyze(requestRate float32) (metrics *AnalysisMetrics, err error) {
+//   - errors are wrapped with the configuration, request size, and rate
+func (qa *QueueAnalyzer) Analyze(requestRate float32) (*AnalysisMetrics, error) {
+	metrics, err := qa.analyze(requestRate, requestRate/1000)
+	if err != nil {
+		return nil, qa.wrapError("analyze", requestRate, err)
+	}
+	return metrics, nil
+}
+
+// evaluate performance metrics given request rate in requests/msec, the native unit of the queueing model
+// (e.g. as GetThroughput of the model), without a round trip through requests/sec
+//   - performance metrics are in their usual units (rates in requests/sec)
+func (qa *QueueAnalyzer) AnalyzeRate(lambdaPerMsec float32) (*AnalysisMetrics, error) {
+	requestRate := lambdaPerMsec * 1000
+	metrics, err := qa.analyze(requestRate, lambdaPerMsec)
+	if err != nil {
+		return nil, qa.wrapError("analyze", requestRate, err)
+	}
+	return metrics, nil
+}
+
+// wrap an error with the configuration, request size, and (offending) request rate, for context in logs
+func (qa *QueueAnalyzer) wrapError(operation string, requestRate float32, err error) error {
+	return fmt.Errorf("%s at rate %v, configuration %s, request size %s: %w", operation, requestRate, qa.configuration(), qa.RequestSize, err)
+}
+
+// evaluate performance metrics given request rate, in requests/sec and requests/msec (errors not wrapped)
+func (qa *QueueAnalyzer) analyze(requestRate float32, lambda float32) (metrics *AnalysisMetrics, err error) {
 	if requestRate <= 0 {
 		return nil, fmt.Errorf("invalid request rate %v", requestRate)
 	}
 	model := qa.Model
 	rateRange := qa.RateRange
 	if requestRate > rateRange.Max {
-		err = fmt.Errorf("rate=%v, max allowed rate=%v", requestRate, rateRange.Max)
-		return nil, err
+		return nil, rateExceedsMax(requestRate, rateRange.Max)
+	}
+	if requestRate < rateRange.Min*(1-minRateTolerance) {
+		// the model is left solved at the min rate, the nearest operating point, for methods evaluated at the
+		// operating point of the solved model (e.g. MemoryUtilization, ServiceTimeCDF)
+		if err = qa.solve(rateRange.Min / 1000); err != nil {
+			return nil, err
+		}
+		return qa.idle(requestRate), nil
 	}
 
 	//solve model
-	model.Solve(requestRate/1000, 1)
-	if !model.IsValid() {
-		err = fmt.Errorf("invalid model %s", model)
+	if err = qa.solve(lambda); err != nil {
 		return nil, err
 	}
 
 	// get statistics
 	avgNumInServ := model.GetAvgNumInServers()
+	avgWaitTime := qa.avgWaitTime()
+	waitScale := qa.waitScale()
 
-	effConc := EffectiveConcurrency(model.GetAvgServTime(), qa.ServiceParms, qa.RequestSize, qa.MaxBatchSize)
-	prefillTime := qa.ServiceParms.Prefill.PrefillTime(qa.RequestSize.AvgInputTokens, effConc)
-	tokenTime := qa.ServiceParms.Decode.DecodeTime(effConc)
+	effConc, err := qa.effectiveConcurrency()
+	if err != nil {
+		return nil, err
+	}
+	prefillTime := qa.timing().PrefillTime(qa.RequestSize.AvgInputTokens, effConc)
+	prefillWaitTime, err := qa.prefillWaitTime(prefillTime)
+	if err != nil {
+		return nil, err
+	}
+	prefillTime += prefillWaitTime
+	tokenTime := qa.tokenTime(effConc)
+	tokenWeights := qa.tokenWeights()
 
-	rho := avgNumInServ / float32(qa.MaxBatchSize)
-	rho = min(max(rho, 0), 1)
+	rho := qa.utilization()
+	respTimePercentiles := model.GetScaledRespTimePercentiles([]float32{0.95, 0.99}, waitScale)
 
 	// return solution
+	throughput := model.GetThroughputPerSecond() * float32(qa.Replicas)
 	metrics = &AnalysisMetrics{
-		Throughput:     model.GetThroughput() * 1000,
-		AvgRespTime:    model.GetAvgRespTime(),
-		AvgWaitTime:    model.GetAvgWaitTime(),
-		AvgNumInServ:   avgNumInServ,
+		OfferedRate:      requestRate,
+		Throughput:       throughput,
+		ThroughputStdDev: qa.throughputStdDev(),
+		Goodput:          throughput,
+		DropRate:         max(requestRate-throughput, 0),
+		PBlock:           model.GetBlockingProbability(),
+		AvgRespTime:      qa.avgRespTime() + prefillWaitTime,
+		AvgWaitTime:      avgWaitTime,
+		P95RespTime:      respTimePercentiles[0],
+		P99RespTime:      respTimePercentiles[1],
+		AvgNumInServ:     avgNumInServ,
+		AvgQueueLength:   model.GetAvgQueueLength() * waitScale,
+		EffConc:          effConc,
+		AvgPrefillTime:   prefillTime,
+		AvgTTFT:          timeToFirstToken(avgWaitTime, prefillTime),
+		AvgTokenTime:     tokenTime,
+		P95TokenTime:     qa.tokenTimePercentile(tokenWeights, 0.95),
+		P99TokenTime:     qa.tokenTimePercentile(tokenWeights, 0.99),
+		MaxRate:          rateRange.Max,
+		Rho:              rho,
+		Regime:           qa.Options.regime(rho, requestRate/rateRange.Max),
+	}
+
+	qa.setCost(metrics)
+	return metrics, nil
+}
+
+// amortize cost of running replicas over processed requests and tokens (throughput) of performance metrics
+func (qa *QueueAnalyzer) setCost(metrics *AnalysisMetrics) {
+	if qa.CostPerSecond > 0 && metrics.Throughput > 0 {
+		metrics.CostPerRequest = qa.CostPerSecond * float32(qa.Replicas) / metrics.Throughput
+		tokens := qa.RequestSize.AvgInputTokens + qa.RequestSize.AvgOutputTokens
+		metrics.CostPerMillionTokens = metrics.CostPerRequest / tokens * 1e6
+	}
+}
+
+// standard deviation of throughput (requests/sec) of all replicas of the solved model,
+// replicas fluctuating independently (variances add)
+func (qa *QueueAnalyzer) throughputStdDev() float32 {
+	return float32(math.Sqrt(float64(qa.Model.GetThroughputVariance())*float64(qa.Replicas))) * 1000
+}
+
+// performance metrics at (essentially) zero load, the service floor: a request alone in the batch, with no waiting
+//   - prefill, TTFT, and token times at batch size one, latency is the average service time at batch size one
+//   - percentiles of latency as for an exponential service time, rates and occupancy are zero
+func (qa *QueueAnalyzer) Baseline() *AnalysisMetrics {
+	avgServTime, _ := qa.serviceMoments()(1)
+	prefillTime := qa.ServiceParms.PrefillTime(qa.RequestSize.AvgInputTokens, 1)
+	return &AnalysisMetrics{
+		AvgRespTime:    avgServTime,
+		P95RespTime:    avgServTime * float32(math.Log(20)),
+		P99RespTime:    avgServTime * float32(math.Log(100)),
+		EffConc:        1,
 		AvgPrefillTime: prefillTime,
-		AvgTokenTime:   tokenTime,
-		MaxRate:        rateRange.Max,
-		Rho:            rho,
+		AvgTTFT:        timeToFirstToken(0, prefillTime),
+		AvgTokenTime:   qa.tokenTime(1),
+		P95TokenTime:   qa.tokenTime(1),
+		P99TokenTime:   qa.tokenTime(1),
+		MaxRate:        qa.RateRange.Max,
+		Regime:         RegimeUnderloaded,
+	}
+}
+
+// performance metrics at an idle request rate (requests/sec), below the min rate of the range: the baseline at the
+// rate, all requests admitted (the model solved at the min rate is not used)
+//   - occupancy by Little's law, the rate of a replica times the latency of a request alone in the batch
+func (qa *QueueAnalyzer) idle(requestRate float32) *AnalysisMetrics {
+	metrics := qa.Baseline()
+	metrics.OfferedRate = requestRate
+	metrics.Throughput = requestRate
+	metrics.Goodput = requestRate
+	metrics.AvgNumInServ = requestRate / float32(qa.Replicas) * metrics.AvgRespTime / 1000
+	metrics.Rho = min(metrics.AvgNumInServ/float32(qa.MaxBatchSize), 1)
+	metrics.Idle = true
+	qa.setCost(metrics)
+	return metrics
+}
+
+// evaluate performance metrics given request rate, as the rate changes over time (e.g. each tick of a live system)
+//   - the model is solved at each update, even if the rate is unchanged, as the parameters of the analyzer (e.g. request
+//     size, replicas, cost) may have changed, and the model may have been solved at other rates since the last update
+//   - the solution is not warm started from the last one: the model is solved directly, by recurrence or by Gaussian
+//     elimination of the tridiagonal balance equations (LinearSolver), in a single pass over its states with no
+//     iterations to save, and a rate change, however small, changes the probabilities of all states
+func (qa *QueueAnalyzer) Update(requestRate float32) (*AnalysisMetrics, error) {
+	return qa.Analyze(requestRate)
+}
+
+// evaluate performance metrics given request rate, with goodput counting only requests meeting target TTFT and ITL
+//   - a request meets target TTFT if its waiting time is at most the target less the prefill time
+//   - the token time is the same for all requests, hence either all or none meet target ITL
+func (qa *QueueAnalyzer) AnalyzeWithTargets(requestRate float32, targetPerf *TargetPerf) (metrics *AnalysisMetrics, err error) {
+	if err = targetPerf.check(); err != nil {
+		return nil, err
+	}
+	if metrics, err = qa.Analyze(requestRate); err != nil {
+		return nil, err
+	}
+	fraction := float32(1)
+	switch {
+	case targetPerf.TargetTTFT > 0 && metrics.Idle:
+		// no waiting at an idle rate
+		if metrics.AvgTTFT > targetPerf.TargetTTFT {
+			fraction = 0
+		}
+	case targetPerf.TargetTTFT > 0:
+		fraction = qa.Model.GetScaledWaitTimeCDF(targetPerf.TargetTTFT-metrics.AvgPrefillTime, qa.waitScale())
+	}
+	if targetPerf.TargetITL > 0 && metrics.AvgTokenTime > targetPerf.TargetITL {
+		fraction = 0
 	}
+	metrics.Goodput = metrics.Throughput * fraction
 	return metrics, nil
 }
 
-// global variables used by eval functions, to be set before calling eval function
-var evalRequestSize *RequestSize   // number of input and output tokens per request
-var evalServiceParms *ServiceParms // request processing parameters for prefill and decode stages
-var evalMaxBatchSize int           // max batch size
+// evaluate performance metrics for each of a list of request rates, reusing the same model
+//   - all rates are checked before solving, so the model is not disturbed by an invalid list
+//   - the model is left solved at the last rate in the list
+func (qa *QueueAnalyzer) AnalyzeRange(rates []float32) (metricsList []*AnalysisMetrics, err error) {
+	return qa.AnalyzeRangeContext(context.Background(), rates)
+}
+
+// same as AnalyzeRange, returning the context error if the context is done between rates
+func (qa *QueueAnalyzer) AnalyzeRangeContext(ctx context.Context, rates []float32) (metricsList []*AnalysisMetrics, err error) {
+	for _, requestRate := range rates {
+		if requestRate <= 0 {
+			return nil, fmt.Errorf("invalid request rate %v, allowed range=%s", requestRate, qa.RateRange)
+		}
+		if requestRate > qa.RateRange.Max {
+			return nil, rateExceedsMax(requestRate, qa.RateRange.Max)
+		}
+	}
+	metricsList = make([]*AnalysisMetrics, len(rates))
+	for i, requestRate := range rates {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if metricsList[i], err = qa.Analyze(requestRate); err != nil {
+			return nil, err
+		}
+	}
+	return metricsList, nil
+}
+
+// evaluate performance metrics at evenly-spaced request rates in [minRate, maxRate], returns
+//   - sampled request rates
+//   - performance metrics at sampled rates
+func (qa *QueueAnalyzer) AnalyzeSweep(minRate float32, maxRate float32, steps int) (rates []float32, metricsList []*AnalysisMetrics, err error) {
+	return qa.AnalyzeSweepContext(context.Background(), minRate, maxRate, steps)
+}
+
+// same as AnalyzeSweep, returning the context error if the context is done between rates
+func (qa *QueueAnalyzer) AnalyzeSweepContext(ctx context.Context, minRate float32, maxRate float32, steps int) (rates []float32, metricsList []*AnalysisMetrics, err error) {
+	if steps < 2 || minRate > maxRate {
+		return nil, nil, fmt.Errorf("invalid sweep: rates=[%v, %v], steps=%d", minRate, maxRate, steps)
+	}
+	rates = make([]float32, steps)
+	delta := (maxRate - minRate) / float32(steps-1)
+	for i := range steps {
+		rates[i] = minRate + float32(i)*delta
+	}
+	rates[steps-1] = maxRate
+	if metricsList, err = qa.AnalyzeRangeContext(ctx, rates); err != nil {
+		return nil, nil, err
+	}
+	return rates, metricsList, nil
+}
+
+// maximum throughput (requests/sec) of the configuration (all replicas), as reported in MaxRate
+//   - the highest request rate for which the model is stable, no analysis needed
+func (qa *QueueAnalyzer) MaxThroughput() float32 {
+	return qa.RateRange.Max
+}
+
+// service rates (requests/sec) of a replica as a function of batch size, as used to build the model,
+// the element at index n-1 is the service rate at batch size n, n=1,2,...,MaxBatchSize (e.g. for plotting)
+func (qa *QueueAnalyzer) ServiceRateCurve() []float32 {
+	servRate := qa.Model.GetServiceRates()
+	for i := range servRate {
+		servRate[i] *= 1000
+	}
+	return servRate
+}
+
+// prefill and token times (msec) of a request as a function of batch size, components of the service rates,
+// the elements at index n-1 are at batch size n, n=1,2,...,MaxBatchSize
+func (qa *QueueAnalyzer) ServiceTimeCurve() (prefillTimes []float32, tokenTimes []float32) {
+	prefillTimes = make([]float32, qa.MaxBatchSize)
+	tokenTimes = make([]float32, qa.MaxBatchSize)
+	for n := 1; n <= qa.MaxBatchSize; n++ {
+		prefillTimes[n-1] = qa.timing().PrefillTime(qa.RequestSize.AvgInputTokens, float32(n))
+		tokenTimes[n-1] = qa.tokenTime(float32(n))
+	}
+	return prefillTimes, tokenTimes
+}
+
+// evaluate request rate (requests/sec) at which utilization (Rho) reaches a target, rho in (0, 1)
+//   - the model is left solved at the last evaluated rate
+func (qa *QueueAnalyzer) RateForUtilization(rho float32) (float32, error) {
+	if rho <= 0 || rho >= 1 {
+		return 0, fmt.Errorf("invalid utilization %v, should be in (0, 1)", rho)
+	}
+	lambdaMin := qa.RateRange.Min / 1000
+	lambdaMax := qa.RateRange.Max / 1000
+	lambda, ind, err := utils.BinarySearch(lambdaMin, lambdaMax, rho, qa.EvalRho)
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate rate for utilization %v, range=%s, err=%v", rho, qa.RateRange, err)
+	}
+	if ind != 0 {
+		return 0, fmt.Errorf("utilization %v not reached within rate range %s, ind=%d", rho, qa.RateRange, ind)
+	}
+	return lambda * 1000, nil
+}
+
+// evaluate performance metrics at the request rate at which utilization (Rho) reaches a target, rho in (0, 1)
+func (qa *QueueAnalyzer) AnalyzeAtUtilization(rho float32) (*AnalysisMetrics, error) {
+	requestRate, err := qa.RateForUtilization(rho)
+	if err != nil {
+		return nil, err
+	}
+	return qa.Analyze(requestRate)
+}
+
+// evaluate max request rate (requests/sec) to achieve a target average response time (msec), as Size does for TTFT and ITL, returns
+//   - max request rate (max rate of the range if the target is met at all rates)
+//   - performance metrics at max request rate
+//   - a TargetInfeasibleError if the target is below the response time at min rate
+func (qa *QueueAnalyzer) RateForRespTime(targetMs float32) (float32, *AnalysisMetrics, error) {
+	if targetMs <= 0 {
+		return 0, nil, fmt.Errorf("invalid target response time %v", targetMs)
+	}
+	lambdaMin := qa.RateRange.Min / 1000
+	lambdaMax := qa.RateRange.Max / 1000
+	lambda, ind, err := utils.BinarySearch(lambdaMin, lambdaMax, targetMs, qa.EvalRespTime)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to calculate rate for response time %v, range=%s, ind=%d, err=%v",
+			targetMs, qa.RateRange, ind, err)
+	}
+	if ind < 0 {
+		return 0, nil, qa.infeasible("RespTime", targetMs, lambdaMin, lambdaMax, qa.EvalRespTime)
+	}
+	requestRate := lambda * 1000
+	metrics, err := qa.Analyze(requestRate)
+	if err != nil {
+		return 0, nil, err
+	}
+	return requestRate, metrics, nil
+}
+
+// evaluate max request rate (requests/sec) keeping the blocking probability within a max value (e.g. 0.01), the analog
+// for a loss system of sizing by latency targets (e.g. for admission control by rejection), returns
+//   - max request rate (max rate of the range if blocking is within the max value at all rates, e.g. unbounded queue)
+//   - performance metrics at max request rate
+//   - a TargetInfeasibleError if the max value is below the blocking probability at min rate
+func (qa *QueueAnalyzer) RateForBlocking(maxPBlock float32) (float32, *AnalysisMetrics, error) {
+	if maxPBlock <= 0 || maxPBlock >= 1 {
+		return 0, nil, fmt.Errorf("invalid max blocking probability %v", maxPBlock)
+	}
+	lambdaMin := qa.RateRange.Min / 1000
+	lambdaMax := qa.RateRange.Max / 1000
+	pBlockMax, err := qa.EvalPBlock(lambdaMax)
+	if err != nil {
+		return 0, nil, err
+	}
+	lambda := lambdaMax
+	if pBlockMax > maxPBlock {
+		var ind int
+		lambda, ind, err = utils.BinarySearch(lambdaMin, lambdaMax, maxPBlock, qa.EvalPBlock)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to calculate rate for blocking probability %v, range=%s, ind=%d, err=%v",
+				maxPBlock, qa.RateRange, ind, err)
+		}
+		if ind < 0 {
+			return 0, nil, qa.infeasible("PBlock", maxPBlock, lambdaMin, lambdaMax, qa.EvalPBlock)
+		}
+	}
+	requestRate := lambda * 1000
+	metrics, err := qa.Analyze(requestRate)
+	if err != nil {
+		return 0, nil, err
+	}
+	return requestRate, metrics, nil
+}
+
+// evaluate max request rate (requests/sec) at which a score of the performance metrics reaches a budget,
+// generalizing the targets of Size to a blended objective (e.g. WeightedLatencyScore), returns
+//   - max request rate (max rate of the range if the score is within budget at all rates)
+//   - performance metrics at max request rate
+//   - a TargetInfeasibleError if the budget is below the score at min rate
+//   - the score should increase with the request rate, each evaluation analyzes the model
+func (qa *QueueAnalyzer) SizeScore(score ScoreFunc, budget float32) (float32, *AnalysisMetrics, error) {
+	if score == nil || budget <= 0 {
+		return 0, nil, fmt.Errorf("invalid score function or budget %v", budget)
+	}
+	eval := func(x float32) (float32, error) {
+		metrics, err := qa.Analyze(min(x*1000, qa.RateRange.Max))
+		if err != nil {
+			return 0, err
+		}
+		return score(metrics), nil
+	}
+	lambdaMin := qa.RateRange.Min / 1000
+	lambdaMax := qa.RateRange.Max / 1000
+	lambda, ind, err := utils.BinarySearch(lambdaMin, lambdaMax, budget, eval)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to calculate rate for score budget %v, range=%s, ind=%d, err=%v",
+			budget, qa.RateRange, ind, err)
+	}
+	if ind < 0 {
+		return 0, nil, qa.infeasible("Score", budget, lambdaMin, lambdaMax, eval)
+	}
+	requestRate := min(lambda*1000, qa.RateRange.Max)
+	metrics, err := qa.Analyze(requestRate)
+	if err != nil {
+		return 0, nil, err
+	}
+	return requestRate, metrics, nil
+}
+
+// score of weighted sum of TTFT and ITL (msec), e.g. for a budget on a blend of both latencies
+func WeightedLatencyScore(weightTTFT float32, weightITL float32) ScoreFunc {
+	return func(metrics *AnalysisMetrics) float32 {
+		return weightTTFT*metrics.AvgTTFT + weightITL*metrics.AvgTokenTime
+	}
+}
+
+// evaluate marginal latency of a request rate (requests/sec), the derivative of AvgRespTime with respect to rate
+// (msec per request/sec), e.g. the cost of more traffic for admission control
+//   - numerical difference of two solves at rates a small step apart (epsilon of analyzer options, relative to max rate),
+//     centered unless the rate is within a step of the ends of the rate range (one-sided)
+//   - a rate outside the rate range is rejected, including one below the min rate (idle in Analyze, with no model
+//     solution to differentiate)
+//   - the model is left solved at the last evaluated rate
+func (qa *QueueAnalyzer) MarginalRespTime(requestRate float32) (float32, error) {
+	rateRange := qa.RateRange
+	if requestRate <= 0 || requestRate < rateRange.Min || requestRate > rateRange.Max {
+		return 0, fmt.Errorf("invalid request rate %v, allowed range=%s", requestRate, rateRange)
+	}
+	step := qa.Options.Epsilon * rateRange.Max
+	low := max(requestRate-step, rateRange.Min)
+	high := min(requestRate+step, rateRange.Max)
+	if high <= low {
+		return 0, fmt.Errorf("rate range %s too narrow to differentiate", rateRange)
+	}
+	respTimeLow, err := qa.EvalRespTime(low / 1000)
+	if err != nil {
+		return 0, qa.wrapError("marginal response time", low, err)
+	}
+	respTimeHigh, err := qa.EvalRespTime(high / 1000)
+	if err != nil {
+		return 0, qa.wrapError("marginal response time", high, err)
+	}
+	return (respTimeHigh - respTimeLow) / (high - low), nil
+}
+
+// locate the knee of the latency curve, the request rate (requests/sec) at which latency starts climbing sharply, returns
+//   - rate of maximum curvature of AvgRespTime versus rate, both normalized to [0, 1], over KneeSamples rates in the rate range
+//   - performance metrics at the knee
+//   - only convex bends are considered (latency flattening at max rate due to blocking is not a knee)
+//   - the model is left solved at the max rate
+func (qa *QueueAnalyzer) KneeRate() (float32, *AnalysisMetrics, error) {
+	rates, metricsList, err := qa.AnalyzeSweep(qa.RateRange.Min, qa.RateRange.Max, KneeSamples)
+	if err != nil {
+		return 0, nil, err
+	}
+	first := metricsList[0].AvgRespTime
+	spread := metricsList[KneeSamples-1].AvgRespTime - first
+	if spread <= 0 {
+		return 0, nil, fmt.Errorf("latency does not increase over rate range %s, no knee", qa.RateRange)
+	}
+	y := func(i int) float64 {
+		return float64((metricsList[i].AvgRespTime - first) / spread)
+	}
+	h := 1 / float64(KneeSamples-1)
+	knee := -1
+	maxCurvature := 0.0
+	for i := 1; i < KneeSamples-1; i++ {
+		slope := (y(i+1) - y(i-1)) / (2 * h)
+		second := (y(i+1) - 2*y(i) + y(i-1)) / (h * h)
+		if curvature := second / math.Pow(1+slope*slope, 1.5); curvature > maxCurvature {
+			knee, maxCurvature = i, curvature
+		}
+	}
+	if knee < 0 {
+		return 0, nil, fmt.Errorf("latency curve has no convex bend over rate range %s, no knee", qa.RateRange)
+	}
+	return rates[knee], metricsList[knee], nil
+}
 
 // evaluate max request rates to achieve a given target performance, returns
 //   - max request rates
 //   - performance metrics at min of max request rates
 //   - achieved values of targets
 func (qa *QueueAnalyzer) Size(targetPerf *TargetPerf) (targetRate *TargetRate, metrics *AnalysisMetrics, achieved *TargetPerf, err error) {
+	return qa.SizeContext(context.Background(), targetPerf)
+}
+
+// same as Size, returning the context error if the context is done between search iterations
+//   - on cancellation the model is left solved at the last evaluated rate
+func (qa *QueueAnalyzer) SizeContext(ctx context.Context, targetPerf *TargetPerf) (targetRate *TargetRate, metrics *AnalysisMetrics, achieved *TargetPerf, err error) {
+	return qa.SizeWithOptions(ctx, targetPerf, nil)
+}
+
+// same as SizeContext, with sizing options (nil for defaults)
+//   - errors other than the context error are wrapped with the configuration, request size, and last evaluated rate
+func (qa *QueueAnalyzer) SizeWithOptions(ctx context.Context, targetPerf *TargetPerf, options *SizeOptions) (targetRate *TargetRate, metrics *AnalysisMetrics, achieved *TargetPerf, err error) {
+	targetRate, metrics, achieved, err = qa.size(ctx, targetPerf, options)
+	if err != nil && err != ctx.Err() {
+		lastRate := qa.Model.GetLambdaPerSecond() * float32(qa.Replicas)
+		return nil, nil, nil, qa.wrapError(fmt.Sprintf("size for targets %s", targetPerf), lastRate, err)
+	}
+	return targetRate, metrics, achieved, err
+}
+
+// same as Size, with targets of explicit presence: nil targets are not considered, and set ones are enforced even if zero
+//   - a zero TTFT or ITL target cannot be achieved at any rate (TargetInfeasibleError), a zero TPS target at all rates
+//   - targets of TargetPerf convert to optional ones (Optional), zero values not considered
+func (qa *QueueAnalyzer) SizeOptional(targets *OptionalTargetPerf) (targetRate *TargetRate, metrics *AnalysisMetrics, achieved *TargetPerf, err error) {
+	if targets == nil {
+		return nil, nil, nil, fmt.Errorf("missing targets")
+	}
+	if err := targets.check(); err != nil {
+		return nil, nil, nil, err
+	}
+	targetPerf := &TargetPerf{}
+	for _, t := range []struct {
+		metric string
+		target *float32
+		value  *float32
+		eval   func(float32) (float32, error)
+	}{
+		{"TTFT", targets.TargetTTFT, &targetPerf.TargetTTFT, qa.EvalTTFT},
+		{"ITL", targets.TargetITL, &targetPerf.TargetITL, qa.EvalITL},
+	} {
+		if t.target == nil {
+			continue
+		}
+		if *t.target == 0 {
+			err := qa.infeasible(t.metric, 0, qa.RateRange.Min/1000, qa.RateRange.Max/1000, t.eval)
+			return nil, nil, nil, qa.wrapError(fmt.Sprintf("size for targets %s", targets), qa.RateRange.Max, err)
+		}
+		*t.value = *t.target
+	}
+	if targets.TargetTPS != nil {
+		targetPerf.TargetTPS = *targets.TargetTPS
+	}
+	return qa.Size(targetPerf)
+}
+
+// evaluate max request rates to achieve a given target performance (errors not wrapped)
+func (qa *QueueAnalyzer) size(ctx context.Context, targetPerf *TargetPerf, options *SizeOptions) (targetRate *TargetRate, metrics *AnalysisMetrics, achieved *TargetPerf, err error) {
+	if options == nil {
+		options = &SizeOptions{}
+	}
+	if err := options.check(); err != nil {
+		return nil, nil, nil, err
+	}
 	if err := targetPerf.check(); err != nil {
 		return nil, nil, nil, err
 	}
@@ -113,110 +799,908 @@ func (qa *QueueAnalyzer) Size(targetPerf *TargetPerf) (targetRate *TargetRate, m
 	lambdaMin := qa.RateRange.Min / 1000
 	lambdaMax := qa.RateRange.Max / 1000
 
-	// set global variables for model and parameters used in functional evaluation
-	utils.Model = qa.Model
-	evalRequestSize = qa.RequestSize
-	evalServiceParms = qa.ServiceParms
-	evalMaxBatchSize = qa.MaxBatchSize
-
 	var ind int
+	converged := true
+	var ttftMetAtMax, itlMetAtMax bool
 
 	// find max rate to achieve target TTFT time
 	lambdaStarTTFT := lambdaMax
 	if targetTTFT > 0 {
-		lambdaStarTTFT, ind, err = utils.BinarySearch(lambdaMin, lambdaMax, targetTTFT, EvalTTFT)
-		if ind < 0 {
-			err = fmt.Errorf("target is below the bounded region")
+		var ok bool
+		lambdaStarTTFT, ind, ok, err = search(lambdaMin, lambdaMax, options.hint(func(h *TargetRate) float32 { return h.RateTargetTTFT }),
+			targetTTFT, options.searchParms("TTFT"), withContext(ctx, qa.EvalTTFT))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, nil, ctxErr
 		}
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("failed to calculate lambdaStarTTFT, targetTTFT=%v, range=%s, ind=%d, err=%v",
+			return nil, nil, nil, fmt.Errorf("failed to calculate lambdaStarTTFT, targetTTFT=%v, range=%s, ind=%d, err=%w",
 				targetTTFT, qa.RateRange, ind, err)
 		}
+		if ind < 0 {
+			return nil, nil, nil, qa.infeasible("TTFT", targetTTFT, lambdaMin, lambdaMax, qa.EvalTTFT)
+		}
+		converged = converged && ok
+		ttftMetAtMax = ind > 0
 	}
 
 	// find max rate to achieve target ITL time
 	lambdaStarITL := lambdaMax
 	if targetITL > 0 {
-		lambdaStarITL, ind, err = utils.BinarySearch(lambdaMin, lambdaMax, targetITL, EvalITL)
-		if ind < 0 {
-			err = fmt.Errorf("target is below the bounded region")
+		var ok bool
+		lambdaStarITL, ind, ok, err = search(lambdaMin, lambdaMax, options.hint(func(h *TargetRate) float32 { return h.RateTargetITL }),
+			targetITL, options.searchParms("ITL"), withContext(ctx, qa.EvalITL))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, nil, ctxErr
 		}
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("failed to calculate lambdaStarITL, targetITL=%v, range=%s, ind=%d, err=%v",
+			return nil, nil, nil, fmt.Errorf("failed to calculate lambdaStarITL, targetITL=%v, range=%s, ind=%d, err=%w",
 				targetITL, qa.RateRange, ind, err)
 		}
+		if ind < 0 {
+			return nil, nil, nil, qa.infeasible("ITL", targetITL, lambdaMin, lambdaMax, qa.EvalITL)
+		}
+		converged = converged && ok
+		itlMetAtMax = ind > 0
 	}
 
-	// find max rate to achieve target TPS
+	// find rate to achieve target TPS, capped by the max rate less the stability safety fraction
 	lambdaStarTPS := lambdaMax
 	if targetTPS > 0 {
-		lambdaStarTPS = lambdaMax * (1 - StabilitySafetyFraction)
+		lambdaCapTPS := lambdaMax * (1 - qa.Options.StabilitySafetyFraction)
+		var ok bool
+		lambdaStarTPS, ind, ok, err = search(lambdaMin, lambdaCapTPS, options.hint(func(h *TargetRate) float32 { return h.RateTargetTPS }),
+			targetTPS, options.searchParms("TPS"), withContext(ctx, qa.EvalTPS))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, nil, ctxErr
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to calculate lambdaStarTPS, targetTPS=%v, range=%s, ind=%d, err=%w",
+				targetTPS, qa.RateRange, ind, err)
+		}
+		if ind > 0 {
+			return nil, nil, nil, qa.infeasible("TPS", targetTPS, lambdaMin, lambdaCapTPS, qa.EvalTPS)
+		}
+		converged = converged && ok
 	}
 
 	// analyze queue with smaller of rates
 	lambda := min(lambdaStarTTFT, lambdaStarITL, lambdaStarTPS)
 	requestRate := lambda * 1000 // convert to per-second rate
-	if metrics, err = qa.Analyze(requestRate); err != nil {
+	var binding string
+	switch {
+	case lambda == lambdaMax:
+	case lambda == lambdaStarTTFT:
+		binding = "TTFT"
+	case lambda == lambdaStarITL:
+		binding = "ITL"
+	default:
+		binding = "TPS"
+	}
+	// analyze at the max rate of each target, then at the chosen rate, leaving the model solved at the chosen rate
+	var metricsAt [3]*AnalysisMetrics
+	if options.AllRates {
+		for i, lambdaStar := range []float32{lambdaStarTTFT, lambdaStarITL, lambdaStarTPS} {
+			if lambdaStar == lambda {
+				continue
+			}
+			if metricsAt[i], err = qa.analyze(lambdaStar*1000, lambdaStar); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	if metrics, err = qa.analyze(requestRate, lambda); err != nil {
 		return nil, nil, nil, err
 	}
+	if options.AllRates {
+		for i := range metricsAt {
+			if metricsAt[i] == nil {
+				metricsAt[i] = metrics
+			}
+		}
+	}
 
 	targetRate = &TargetRate{
 		RateTargetTTFT: lambdaStarTTFT * 1000,
 		RateTargetITL:  lambdaStarITL * 1000,
 		RateTargetTPS:  lambdaStarTPS * 1000,
+		Converged:      converged,
+		TTFTMetAtMax:   ttftMetAtMax,
+		ITLMetAtMax:    itlMetAtMax,
+		Rate:           requestRate,
+		Binding:        binding,
+		MetricsTTFT:    metricsAt[0],
+		MetricsITL:     metricsAt[1],
+		MetricsTPS:     metricsAt[2],
+	}
+
+	return targetRate, metrics, qa.achievedPerf(metrics), nil
+}
+
+// error for a target which cannot be achieved at any rate, with the range of achievable values
+func (qa *QueueAnalyzer) infeasible(metric string, target float32, lambdaMin float32, lambdaMax float32,
+	eval func(float32) (float32, error)) error {
+	e := &TargetInfeasibleError{Metric: metric, Target: target}
+	var err error
+	if e.MinValue, err = eval(lambdaMin); err != nil {
+		return fmt.Errorf("failed to evaluate %s at min rate, err=%v", metric, err)
 	}
+	if e.MaxValue, err = eval(lambdaMax); err != nil {
+		return fmt.Errorf("failed to evaluate %s at max rate, err=%v", metric, err)
+	}
+	return e
+}
+
+// evaluate the ranges of target values achievable over the range of request rates (e.g. to constrain targets given
+// to sizing), returns
+//   - min target performance: TTFT and ITL at the lowest rate (the best achievable), TPS at the lowest rate
+//   - max target performance: TTFT and ITL at the max rate (met by any rate above), TPS at the max rate of a TPS target
+//     (max rate less the stability safety fraction, as in sizing)
+//   - the model is left solved at the max rate
+func (qa *QueueAnalyzer) FeasibleTargets() (minPerf *TargetPerf, maxPerf *TargetPerf, err error) {
+	lambdaMin := qa.RateRange.Min / 1000
+	lambdaMax := qa.RateRange.Max / 1000
+	lambdaTPS := lambdaMax * (1 - qa.Options.StabilitySafetyFraction)
+	var metricsMin, metricsTPS, metricsMax *AnalysisMetrics
+	if metricsMin, err = qa.analyze(lambdaMin*1000, lambdaMin); err != nil {
+		return nil, nil, fmt.Errorf("failed to analyze at min rate, err=%w", err)
+	}
+	if metricsTPS, err = qa.analyze(lambdaTPS*1000, lambdaTPS); err != nil {
+		return nil, nil, fmt.Errorf("failed to analyze at max rate of TPS target, err=%w", err)
+	}
+	if metricsMax, err = qa.analyze(lambdaMax*1000, lambdaMax); err != nil {
+		return nil, nil, fmt.Errorf("failed to analyze at max rate, err=%w", err)
+	}
+	minPerf = qa.achievedPerf(metricsMin)
+	maxPerf = qa.achievedPerf(metricsMax)
+	maxPerf.TargetTPS = qa.achievedPerf(metricsTPS).TargetTPS
+	return minPerf, maxPerf, nil
+}
 
-	achieved = &TargetPerf{
-		TargetTTFT: metrics.AvgWaitTime + metrics.AvgPrefillTime,
+// evaluate max request rates to achieve a given target performance for each of a list of request size profiles,
+// rebuilding the model of the same configuration per profile
+//   - the most restrictive profile has the smallest max rates
+//   - the analyzer itself is left unchanged
+func (qa *QueueAnalyzer) SizeMulti(profiles []*RequestSize, targetPerf *TargetPerf) (targetRates []*TargetRate, err error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no request size profiles")
+	}
+	if err := targetPerf.check(); err != nil {
+		return nil, err
+	}
+	config := qa.configuration()
+	targetRates = make([]*TargetRate, len(profiles))
+	for i, requestSize := range profiles {
+		if requestSize == nil {
+			return nil, fmt.Errorf("missing request size profile %d", i)
+		}
+		if err = requestSize.check(); err != nil {
+			return nil, fmt.Errorf("profile %d: %v", i, err)
+		}
+		moments := singleClassMoments(config.timing(), requestSize)
+		if err = checkModel(config, requestSize, moments); err != nil {
+			return nil, fmt.Errorf("profile %d: %v", i, err)
+		}
+		candidate := buildModel(config, requestSize, moments)
+		if targetRates[i], _, _, err = candidate.Size(targetPerf); err != nil {
+			return nil, fmt.Errorf("profile %d: %v", i, err)
+		}
+	}
+	return targetRates, nil
+}
+
+// headroom of a current request rate against the max rates of a sizing (e.g. as an autoscaling signal), returns
+//   - fraction of capacity used, current rate over the most restrictive (smallest) max rate (above one if over capacity)
+//   - target binding the capacity (TTFT, ITL, TPS), empty if all max rates are equal (e.g. no targets)
+func Headroom(currentRate float32, targetRate *TargetRate) (used float32, binding string, err error) {
+	if targetRate == nil || currentRate < 0 {
+		return 0, "", fmt.Errorf("invalid current rate %v or sizing result %s", currentRate, targetRate)
+	}
+	rates := []float32{targetRate.RateTargetTTFT, targetRate.RateTargetITL, targetRate.RateTargetTPS}
+	capacity := min(rates[0], rates[1], rates[2])
+	if capacity <= 0 {
+		return 0, "", fmt.Errorf("no capacity in sizing result %s", targetRate)
+	}
+	if rates[0] != rates[1] || rates[1] != rates[2] {
+		for i, name := range []string{"TTFT", "ITL", "TPS"} {
+			if rates[i] == capacity {
+				binding = name
+				break
+			}
+		}
+	}
+	return currentRate / capacity, binding, nil
+}
+
+// evaluate min number of identical replicas of the configuration (replicas of the analyzer ignored) to achieve a given
+// target performance at a given (total) request rate, evenly split among replicas
+//   - the max rate of a single replica (Size) divides the request rate (rounded up), then the targets are re-checked
+//     at the resulting per-replica rate, adding a replica if missed (e.g. within the search tolerance)
+//   - a TPS target caps the rate of a replica by its max rate less the stability safety fraction
+//   - the analyzer itself is left unchanged
+func (qa *QueueAnalyzer) RequiredReplicas(requestRate float32, targetPerf *TargetPerf) (int, error) {
+	if requestRate <= 0 {
+		return 0, fmt.Errorf("invalid request rate %v", requestRate)
+	}
+	config := qa.configuration()
+	config.Replicas = 1
+	single := buildModel(config, qa.RequestSize, qa.serviceMoments())
+	if err := targetPerf.check(); err != nil {
+		return 0, err
+	}
+	latencyTargets := &TargetPerf{TargetTTFT: targetPerf.TargetTTFT, TargetITL: targetPerf.TargetITL}
+	targetRate, _, _, err := single.Size(latencyTargets)
+	if err != nil {
+		return 0, err
+	}
+	rate := targetRate.Rate
+	if targetPerf.TargetTPS > 0 {
+		rate = min(rate, single.RateRange.Max*(1-qa.Options.StabilitySafetyFraction))
+	}
+	replicas := int(math.Ceil(float64(requestRate / rate)))
+	for n := max(replicas, 1); n <= replicas+1; n++ {
+		config.Replicas = n
+		candidate := buildModel(config, qa.RequestSize, qa.serviceMoments())
+		if targetPerf.TargetTPS > 0 && requestRate > candidate.RateRange.Max*(1-qa.Options.StabilitySafetyFraction) {
+			continue
+		}
+		metrics, err := candidate.Analyze(requestRate)
+		if err != nil {
+			continue
+		}
+		if latencyTargets.isAchieved(candidate.achievedPerf(metrics)) {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("targets %s not achieved at rate=%v with %d replicas", targetPerf, requestRate, replicas+1)
+}
+
+// evaluate min batch size to achieve a given target performance at a given request rate, returns
+//   - min batch size (up to BatchSizeCeiling, or the max batch size limit if smaller)
+//   - performance metrics at min batch size
+func (qa *QueueAnalyzer) SizeBatch(requestRate float32, targetPerf *TargetPerf) (batchSize int, metrics *AnalysisMetrics, err error) {
+	return qa.SizeBatchContext(context.Background(), requestRate, targetPerf)
+}
+
+// same as SizeBatch, returning the context error if the context is done between batch sizes
+func (qa *QueueAnalyzer) SizeBatchContext(ctx context.Context, requestRate float32, targetPerf *TargetPerf) (batchSize int, metrics *AnalysisMetrics, err error) {
+	if err := targetPerf.check(); err != nil {
+		return 0, nil, err
+	}
+	if requestRate <= 0 {
+		return 0, nil, fmt.Errorf("invalid request rate %v", requestRate)
+	}
+
+	// rebuild model for increasing batch sizes
+	config := qa.configuration()
+	ceiling := min(BatchSizeCeiling, qa.Options.batchSizeLimit())
+	for n := 1; n <= ceiling; n++ {
+		if err = ctx.Err(); err != nil {
+			return 0, nil, err
+		}
+		config.MaxBatchSize = n
+		config.FractionalMaxBatch = 0
+		candidate := buildModel(config, qa.RequestSize, qa.serviceMoments())
+		if requestRate > candidate.RateRange.Max {
+			continue
+		}
+		if metrics, err = candidate.Analyze(requestRate); err != nil {
+			continue
+		}
+		if targetPerf.isAchieved(candidate.achievedPerf(metrics)) {
+			return n, metrics, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("no batch size up to %d achieves targets %s at rate=%v", ceiling, targetPerf, requestRate)
+}
+
+// create a deep copy of the analyzer, including the solved state of its model, to be solved independently
+//   - changing parameters of the copy requires rebuilding its model (BuildModel)
+func (qa *QueueAnalyzer) Clone() *QueueAnalyzer {
+	options := *qa.Options
+	rateRange := *qa.RateRange
+	var kvCache *KVCacheParms
+	if qa.KVCache != nil {
+		kv := *qa.KVCache
+		kvCache = &kv
+	}
+	var classes []*WorkloadClass
+	for _, c := range qa.classes {
+		classes = append(classes, &WorkloadClass{Name: c.Name, RequestSize: c.RequestSize.clone(), ArrivalFraction: c.ArrivalFraction})
+	}
+	return &QueueAnalyzer{
+		MaxBatchSize:          qa.MaxBatchSize,
+		ConfigMaxBatchSize:    qa.ConfigMaxBatchSize,
+		FractionalMaxBatch:    qa.FractionalMaxBatch,
+		KVCache:               kvCache,
+		MaxQueueSize:          qa.MaxQueueSize,
+		LossOnly:              qa.LossOnly,
+		MaxPrefillConcurrency: qa.MaxPrefillConcurrency,
+		MaxPrefillBatch:       qa.MaxPrefillBatch,
+		MaxDecodeBatch:        qa.MaxDecodeBatch,
+		Unbounded:             qa.Unbounded,
+		Replicas:              qa.Replicas,
+		CostPerSecond:         qa.CostPerSecond,
+		ServiceParms:          qa.ServiceParms.clone(),
+		RequestSize:           qa.RequestSize.clone(),
+		Options:               &options,
+		ServiceSCV:            qa.ServiceSCV,
+		ArrivalSCV:            qa.ArrivalSCV,
+		Model:                 qa.Model.Clone(),
+		RateRange:             &rateRange,
+		classes:               classes,
+	}
+}
+
+// configuration of queue analyzer
+func (qa *QueueAnalyzer) configuration() *Configuration {
+	maxBatchSize := qa.ConfigMaxBatchSize
+	if maxBatchSize == 0 {
+		maxBatchSize = qa.MaxBatchSize
+	}
+	return &Configuration{
+		MaxBatchSize:          maxBatchSize,
+		FractionalMaxBatch:    qa.FractionalMaxBatch,
+		MaxQueueSize:          qa.MaxQueueSize,
+		LossOnly:              qa.LossOnly,
+		MaxPrefillConcurrency: qa.MaxPrefillConcurrency,
+		MaxPrefillBatch:       qa.MaxPrefillBatch,
+		MaxDecodeBatch:        qa.MaxDecodeBatch,
+		Unbounded:             qa.Unbounded,
+		Replicas:              qa.Replicas,
+		CostPerSecond:         qa.CostPerSecond,
+		ArrivalSCV:            qa.ArrivalSCV,
+		ServiceParms:          qa.ServiceParms,
+		KVCache:               qa.KVCache,
+		Options:               qa.Options,
+	}
+}
+
+// values of target metrics achieved by performance metrics
+func (qa *QueueAnalyzer) achievedPerf(metrics *AnalysisMetrics) *TargetPerf {
+	return &TargetPerf{
+		TargetTTFT: metrics.AvgTTFT,
 		TargetITL:  metrics.AvgTokenTime,
-		TargetTPS:  metrics.Throughput * float32(qa.RequestSize.AvgOutputTokens),
+		TargetTPS:  metrics.Throughput * qa.RequestSize.AvgOutputTokens,
+	}
+}
+
+func (p *PrefillParms) PrefillTime(avgInputTokens float32, batchSize float32) float32 {
+	if avgInputTokens == 0 {
+		return 0
 	}
-	return targetRate, metrics, achieved, nil
+	return p.Gamma + p.Delta*p.uncachedTokens(avgInputTokens)*batchSize
 }
 
-func (p *PrefillParms) PrefillTime(avgInputTokens int, batchSize float32) float32 {
+// number of input tokens not found in the prompt cache, hence processed by prefill
+//   - the base prefill time applies to a request with input tokens, even if all are cached
+func (p *PrefillParms) uncachedTokens(avgInputTokens float32) float32 {
+	return avgInputTokens * (1 - p.CacheHitRate)
+}
+
+// chunked prefill: prompt processed in chunks, each sharing an iteration with a decode step of the batch
+//   - prefill time = gamma + delta * inputTokens + numChunks * decodeTime(batchSize)
+func (p *PrefillParms) PrefillTimeChunked(avgInputTokens float32, batchSize float32, decode DecodeModel) float32 {
 	if avgInputTokens == 0 {
 		return 0
 	}
-	return p.Gamma + p.Delta*float32(avgInputTokens)*batchSize
+	uncached := p.uncachedTokens(avgInputTokens)
+	return p.Gamma + p.Delta*uncached + p.NumChunks(uncached)*decode.DecodeTime(batchSize)
+}
+
+// number of prefill chunks of a prompt (zero if prefill not chunked)
+//   - a fractional number of input tokens is rounded up to a whole chunk
+func (p *PrefillParms) NumChunks(avgInputTokens float32) float32 {
+	if p.ChunkSize <= 0 {
+		return 0
+	}
+	return float32(math.Ceil(float64(avgInputTokens) / float64(p.ChunkSize)))
+}
+
+// prefill time of a request, by the prefill time model if given, otherwise chunked if a chunk size is configured
+func (sp *ServiceParms) PrefillTime(avgInputTokens float32, batchSize float32) float32 {
+	switch {
+	case sp.PrefillModel != nil:
+		return sp.PrefillModel.PrefillTime(avgInputTokens, batchSize)
+	case sp.Prefill.ChunkSize > 0:
+		return sp.Prefill.PrefillTimeChunked(avgInputTokens, batchSize, sp.decodeModel())
+	}
+	return sp.Prefill.PrefillTime(avgInputTokens, batchSize)
 }
 
 func (p *DecodeParms) DecodeTime(batchSize float32) float32 {
-	return p.Alpha + p.Beta*batchSize
+	alpha, beta := p.segment(p.segmentIndex(batchSize))
+	return alpha + beta*batchSize
+}
+
+// index of the segment of a piecewise-linear decode time containing a batch size (zero if linear)
+func (p *DecodeParms) segmentIndex(batchSize float32) int {
+	i := 0
+	for i+1 < len(p.Breakpoints) && p.Breakpoints[i+1] <= batchSize {
+		i++
+	}
+	return i
+}
+
+// intercept and slope of the decode time over a segment, alpha and beta if linear
+//   - intercepts follow from continuity at breakpoints
+func (p *DecodeParms) segment(index int) (alpha float32, beta float32) {
+	if len(p.Breakpoints) == 0 {
+		return p.Alpha, p.Beta
+	}
+	alpha = p.Alpha
+	for i := 1; i <= index; i++ {
+		alpha += (p.Slopes[i-1] - p.Slopes[i]) * p.Breakpoints[i]
+	}
+	return alpha, p.Slopes[index]
+}
+
+// speculative decoding: decode time per token, given the probability that a draft token is accepted
+// and the number of draft tokens per forward pass
+func (p *DecodeParms) DecodeTimeSpeculative(batchSize float32, acceptanceRate float32, draftLength int) float32 {
+	return p.DecodeTime(batchSize) / TokensPerPass(acceptanceRate, draftLength)
+}
+
+// expected number of tokens generated per forward pass of speculative decoding:
+// accepted prefix of the draft, plus one token generated by the target model
+//   - (1 - a^(k+1)) / (1 - a) for acceptance rate a and draft length k
+func TokensPerPass(acceptanceRate float32, draftLength int) float32 {
+	if acceptanceRate >= 1 {
+		return float32(draftLength + 1)
+	}
+	a := float64(acceptanceRate)
+	return float32((1 - math.Pow(a, float64(draftLength+1))) / (1 - a))
+}
+
+// decode time per token, by the decode time model if given, speculative if speculative decoding parameters are given
+func (sp *ServiceParms) DecodeTime(batchSize float32) float32 {
+	if sp.Speculative != nil {
+		return sp.decodeModel().DecodeTime(batchSize) / TokensPerPass(sp.Speculative.AcceptanceRate, sp.Speculative.DraftLength)
+	}
+	return sp.decodeModel().DecodeTime(batchSize)
+}
+
+// average decode time per token of a request given the batch size and its number of output tokens, including the
+// growth of decode time with position averaged over the output (decode parameters with a position slope)
+//   - the k-th decode step of a request (k = 1, ..., outputTokens-1) takes positionSlope * k longer, on average
+//     positionSlope * outputTokens / 2
+func (sp *ServiceParms) TokenTime(batchSize float32, outputTokens float32) float32 {
+	return sp.DecodeTime(batchSize) + sp.positionTime(outputTokens)
+}
+
+// average growth of decode time per token with position over the output of a request (zero if no position slope)
+func (sp *ServiceParms) positionTime(outputTokens float32) float32 {
+	if sp.Decode == nil {
+		return 0
+	}
+	return sp.Decode.PositionSlope * outputTokens / 2
+}
+
+// decode time model of a forward pass, the decode parameters unless a model is given
+func (sp *ServiceParms) decodeModel() DecodeModel {
+	if sp.DecodeModel != nil {
+		return sp.DecodeModel
+	}
+	return sp.Decode
+}
+
+// service time is given by an alternative timing model (not linear in batch size)
+func (sp *ServiceParms) pluggable() bool {
+	return sp.PrefillModel != nil || sp.DecodeModel != nil
+}
+
+// timing of request processing of the analyzer, with the batch sizes of prefill and decode limited by their ceilings
+func (qa *QueueAnalyzer) timing() *ServiceParms {
+	return stageTiming(qa.ServiceParms, qa.MaxPrefillBatch, qa.MaxDecodeBatch, qa.MaxBatchSize)
+}
+
+// timing of request processing given processing parameters, with the batch sizes of prefill and decode limited by
+// ceilings, the parameters themselves if neither ceiling is below the max batch size (zero if not limited)
+//   - a stage processes at most c (ceiling) requests at a time, so a batch of n > c requests is processed in n/c rounds,
+//     each taking the time of a batch of c requests (the throughput of the stage saturates at the ceiling)
+//   - the limited timing is an alternative timing model, hence effective concurrency is solved numerically
+func stageTiming(parms *ServiceParms, maxPrefillBatch int, maxDecodeBatch int, maxBatchSize int) *ServiceParms {
+	limited := func(ceiling int) bool {
+		return ceiling > 0 && ceiling < maxBatchSize
+	}
+	if !limited(maxPrefillBatch) && !limited(maxDecodeBatch) {
+		return parms
+	}
+	return &ServiceParms{
+		Prefill:      parms.Prefill,
+		Decode:       parms.Decode,
+		PrefillModel: &stagePrefill{parms: parms, maxBatch: float32(maxPrefillBatch)},
+		DecodeModel:  &stageDecode{parms: parms, maxBatch: float32(maxDecodeBatch)},
+	}
+}
+
+// prefill time of processing parameters with a ceiling on the prefill batch size (zero if not limited)
+type stagePrefill struct {
+	parms    *ServiceParms
+	maxBatch float32
+}
+
+func (p *stagePrefill) PrefillTime(avgInputTokens float32, batchSize float32) float32 {
+	if p.maxBatch > 0 && batchSize > p.maxBatch {
+		return p.parms.PrefillTime(avgInputTokens, p.maxBatch) * batchSize / p.maxBatch
+	}
+	return p.parms.PrefillTime(avgInputTokens, batchSize)
+}
+
+// decode time (speculative if given) of processing parameters with a ceiling on the decode batch size (zero if not limited)
+type stageDecode struct {
+	parms    *ServiceParms
+	maxBatch float32
+}
+
+func (d *stageDecode) DecodeTime(batchSize float32) float32 {
+	if d.maxBatch > 0 && batchSize > d.maxBatch {
+		return d.parms.DecodeTime(d.maxBatch) * batchSize / d.maxBatch
+	}
+	return d.parms.DecodeTime(batchSize)
+}
+
+// speedup of decoding, expected number of tokens per forward pass (one if not speculative)
+func (sp *ServiceParms) decodeSpeedup() float32 {
+	if sp.Speculative != nil {
+		return TokensPerPass(sp.Speculative.AcceptanceRate, sp.Speculative.DraftLength)
+	}
+	return 1
+}
+
+// service time (prefill and decode) of a request given its number of tokens and the batch size
+func ServiceTime(parms *ServiceParms, inputTokens float32, outputTokens float32, batchSize float32) float32 {
+	prefillTime := parms.PrefillTime(inputTokens, batchSize)
+	decodeTime := (outputTokens - 1) * parms.TokenTime(batchSize, outputTokens)
+	return prefillTime + decodeTime
+}
+
+// calculate mean and squared coefficient of variation (SCV) of request service time given the batch size
+//   - service time is exponential around the mean of a size bucket (SCV=1), as in the averages only case
+//   - with a distribution, service time is a mixture (hyperexponential) over the buckets (SCV>=1)
+func ServiceTimeMoments(parms *ServiceParms, requestSize *RequestSize, batchSize float32) (mean float32, scv float32) {
+	if len(requestSize.Distribution) == 0 {
+		return ServiceTime(parms, requestSize.AvgInputTokens, requestSize.AvgOutputTokens, batchSize), 1
+	}
+	var sumWeights, sumFirst, sumSecond float64
+	for _, b := range requestSize.Distribution {
+		t := float64(ServiceTime(parms, float32(b.InputTokens), float32(b.OutputTokens), batchSize))
+		w := float64(b.Weight)
+		sumWeights += w
+		sumFirst += w * t
+		sumSecond += w * 2 * t * t
+	}
+	first := sumFirst / sumWeights
+	second := sumSecond / sumWeights
+	return float32(first), float32(second/(first*first) - 1)
+}
+
+// average waiting time, adjusted for variability of interarrival and service times
+func (qa *QueueAnalyzer) avgWaitTime() float32 {
+	return qa.Model.GetAvgWaitTime() * qa.waitScale()
+}
+
+// scale of the model waiting time accounting for variability of interarrival and service times
+//   - ratio of G/G/1 to M/M/1 waiting time (Allen-Cunneen approximation) is (arrival SCV + service SCV) / 2,
+//     with Poisson arrivals (SCV one) the ratio of M/G/1 to M/M/1 waiting time (Pollaczek-Khinchine)
+//   - no waiting in a loss system
+func (qa *QueueAnalyzer) waitScale() float32 {
+	if qa.LossOnly {
+		return 0
+	}
+	arrivalSCV := qa.ArrivalSCV
+	if arrivalSCV == 0 {
+		arrivalSCV = 1
+	}
+	return (arrivalSCV + qa.ServiceSCV) / 2
 }
 
-// Function used in binary search (target TTFT)
+// binary search over lambda (req/msec), warm started if a hint (req/sec) is given, returns
+//   - lambda found, or the low end of the last bracket if the search did not converge (metric increasing with lambda)
+//   - indicator of target below (-1), within (0), or above (+1) the range
+//   - whether the search converged
+func search(lambdaMin float32, lambdaMax float32, hintRate float32, yTarget float32, parms *utils.SearchParms,
+	eval func(float32) (float32, error)) (lambda float32, ind int, converged bool, err error) {
+	r, err := utils.BinarySearchWithParms(lambdaMin, lambdaMax, hintRate/1000, yTarget, parms, eval)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !r.Converged {
+		return r.XLow, r.Indicator, false, nil
+	}
+	return r.XStar, r.Indicator, true, nil
+}
+
+// wrap function used in binary search to fail once the context is done
+func withContext(ctx context.Context, eval func(float32) (float32, error)) func(float32) (float32, error) {
+	return func(x float32) (float32, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return eval(x)
+	}
+}
+
+// solve the model of a single replica given the total arrival rate
+//   - lambda is total req/msec, split evenly among replicas
+func (qa *QueueAnalyzer) solve(lambda float32) error {
+	model := qa.Model
+	if _, err := model.SolveChecked(lambda/float32(qa.Replicas), 1); err != nil {
+		return fmt.Errorf("invalid model %s: %w, diagnostics %s", model, err, model.Diagnostics())
+	}
+	return nil
+}
+
+// Function used in binary search (target TTFT), bound to the analyzer's model
+//   - x is lambda req/msec
+func (qa *QueueAnalyzer) EvalTTFT(x float32) (float32, error) {
+	if err := qa.solve(x); err != nil {
+		return 0, err
+	}
+	effConc, err := qa.effectiveConcurrency()
+	if err != nil {
+		return 0, err
+	}
+	prefillTime := qa.timing().PrefillTime(qa.RequestSize.AvgInputTokens, effConc)
+	prefillWaitTime, err := qa.prefillWaitTime(prefillTime)
+	if err != nil {
+		return 0, err
+	}
+	return timeToFirstToken(qa.avgWaitTime(), prefillTime+prefillWaitTime), nil
+}
+
+// time to first token: queueing time followed by prefill time
+func timeToFirstToken(waitTime float32, prefillTime float32) float32 {
+	return waitTime + prefillTime
+}
+
+// Function used in binary search (target ITL), bound to the analyzer's model
+//   - x is lambda req/msec
+func (qa *QueueAnalyzer) EvalITL(x float32) (float32, error) {
+	if err := qa.solve(x); err != nil {
+		return 0, err
+	}
+	effConc, err := qa.effectiveConcurrency()
+	if err != nil {
+		return 0, err
+	}
+	return qa.tokenTime(effConc), nil
+}
+
+// Function used in binary search (max blocking probability), bound to the analyzer's model
 //   - x is lambda req/msec
-func EvalTTFT(x float32) (float32, error) {
-	utils.Model.Solve(x, 1)
-	if !utils.Model.IsValid() {
-		return 0, fmt.Errorf("invalid model %s", utils.Model)
+func (qa *QueueAnalyzer) EvalPBlock(x float32) (float32, error) {
+	if err := qa.solve(x); err != nil {
+		return 0, err
 	}
-	avgWaitTime := utils.Model.GetAvgWaitTime()
-	effConc := EffectiveConcurrency(utils.Model.GetAvgServTime(), evalServiceParms, evalRequestSize, evalMaxBatchSize)
-	ttft := avgWaitTime + evalServiceParms.Prefill.PrefillTime(evalRequestSize.AvgInputTokens, effConc)
-	return ttft, nil
+	return qa.Model.GetBlockingProbability(), nil
 }
 
-// Function used in binary search (target ITL)
+// Function used in binary search (target TPS), bound to the analyzer's model
 //   - x is lambda req/msec
-func EvalITL(x float32) (float32, error) {
-	utils.Model.Solve(x, 1)
-	if !utils.Model.IsValid() {
-		return 0, fmt.Errorf("invalid model %s", utils.Model)
+func (qa *QueueAnalyzer) EvalTPS(x float32) (float32, error) {
+	if err := qa.solve(x); err != nil {
+		return 0, err
 	}
-	effConc := EffectiveConcurrency(utils.Model.GetAvgServTime(), evalServiceParms, evalRequestSize, evalMaxBatchSize)
-	return evalServiceParms.Decode.DecodeTime(effConc), nil
+	return qa.Model.GetThroughputPerSecond() * float32(qa.Replicas) * qa.RequestSize.AvgOutputTokens, nil
+}
+
+// weights of batch sizes (index) in the distribution of token decode time over tokens, of the solved model
+//   - a request in a batch of b requests generates tokens at rate 1/tokenTime(b), hence the fraction of tokens
+//     decoded at batch size b is proportional to b * P[batch size b] / tokenTime(b)
+//   - the mean of the distribution agrees with the token time at effective concurrency
+func (qa *QueueAnalyzer) tokenWeights() []float64 {
+	return qa.batchTokenWeights(qa.Model.GetStateProbabilities(), qa.Model.GetProbBatchFull())
+}
+
+// weights of batch sizes (index) in the distribution of token decode time over tokens, given state probabilities
+// and the probability that the batch is full
+func (qa *QueueAnalyzer) batchTokenWeights(probs []float32, probBatchFull float32) []float64 {
+	weights := make([]float64, qa.MaxBatchSize+1)
+	for b := 1; b <= qa.MaxBatchSize && b < len(probs); b++ {
+		p := float64(probs[b])
+		if b == qa.MaxBatchSize {
+			p = float64(probBatchFull)
+		}
+		weights[b] = p * float64(b) / float64(qa.tokenTime(float32(b)))
+	}
+	return weights
+}
+
+// percentile of token decode time given weights of batch sizes (index), p in (0, 1)
+//   - token time increases with batch size, the percentile is the token time of the smallest batch size
+//     covering a fraction p of the tokens (token time at batch size one if there are no tokens)
+func (qa *QueueAnalyzer) tokenTimePercentile(weights []float64, p float32) float32 {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	var sum float64
+	for b := 1; b < len(weights); b++ {
+		sum += weights[b]
+		if total > 0 && sum >= float64(p)*total {
+			return qa.tokenTime(float32(b))
+		}
+	}
+	return qa.tokenTime(1)
+}
+
+// average decode time per token of a request of the analyzer given the batch size, including growth with position
+func (qa *QueueAnalyzer) tokenTime(batchSize float32) float32 {
+	return qa.timing().TokenTime(batchSize, qa.RequestSize.AvgOutputTokens)
+}
+
+// effective average number of requests in service of the solved model
+func (qa *QueueAnalyzer) effectiveConcurrency() (float32, error) {
+	return EffectiveConcurrency(qa.Model.GetAvgServTime(), qa.timing(), qa.RequestSize, qa.MaxBatchSize)
+}
+
+// Function used in binary search (target response time), bound to the analyzer's model
+//   - x is lambda req/msec
+func (qa *QueueAnalyzer) EvalRespTime(x float32) (float32, error) {
+	if err := qa.solve(x); err != nil {
+		return 0, err
+	}
+	if qa.MaxPrefillConcurrency == 0 {
+		return qa.avgRespTime(), nil
+	}
+	effConc, err := qa.effectiveConcurrency()
+	if err != nil {
+		return 0, err
+	}
+	prefillWaitTime, err := qa.prefillWaitTime(qa.timing().PrefillTime(qa.RequestSize.AvgInputTokens, effConc))
+	if err != nil {
+		return 0, err
+	}
+	return qa.avgRespTime() + prefillWaitTime, nil
+}
+
+// average time an admitted request waits for a prefill slot of the solved model, given the prefill time
+// (zero if prefill concurrency is not limited, or there is no prefill)
+//   - approximation: prefills of a replica form an M/M/c queue (c prefill slots), with the throughput of the replica
+//     as arrival rate and the prefill time as service time, neglecting the effect of waiting on the batch occupancy
+//   - the rate range keeps the prefill load below the number of slots
+func (qa *QueueAnalyzer) prefillWaitTime(prefillTime float32) (float32, error) {
+	slots := qa.MaxPrefillConcurrency
+	if slots <= 0 || slots >= qa.MaxBatchSize || prefillTime <= 0 {
+		return 0, nil
+	}
+	load := float64(qa.Model.GetThroughput()) * float64(prefillTime)
+	if load >= float64(slots) {
+		return 0, fmt.Errorf("prefill load %v saturates %d prefill slots", load, slots)
+	}
+	return float32(erlangC(slots, load) * float64(prefillTime) / (float64(slots) - load)), nil
+}
+
+// probability of waiting in an M/M/c queue with c servers and offered load a < c (Erlang C formula),
+// from the blocking probability of the Erlang B recurrence
+func erlangC(c int, a float64) float64 {
+	b := 1.0
+	for k := 1; k <= c; k++ {
+		b = a * b / (float64(k) + a*b)
+	}
+	return b / (1 - a/float64(c)*(1-b))
+}
+
+// average response time of the solved model, with the average waiting time accounting for service time variability
+func (qa *QueueAnalyzer) avgRespTime() float32 {
+	return qa.Model.GetAvgRespTime() + qa.avgWaitTime() - qa.Model.GetAvgWaitTime()
+}
+
+// Function used in binary search (target utilization), bound to the analyzer's model
+//   - x is lambda req/msec
+func (qa *QueueAnalyzer) EvalRho(x float32) (float32, error) {
+	if err := qa.solve(x); err != nil {
+		return 0, err
+	}
+	return qa.utilization(), nil
+}
+
+// utilization of a replica, average fraction of batch slots in use
+func (qa *QueueAnalyzer) utilization() float32 {
+	rho := qa.Model.GetAvgNumInServers() / float32(qa.MaxBatchSize)
+	return min(max(rho, 0), 1)
+}
+
+// expected KV cache memory utilization of a replica at the operating point of the solved model (e.g. after Analyze),
+// given the memory budget (bytes) and KV cache footprint of a token (bytes) of a replica
+//   - a request holds the KV cache of its full sequence (average input and output tokens), as with KV cache memory
+//   - conservatively, queued requests are counted as if holding memory too (e.g. engines reserving it on arrival), as
+//     many as the average queue length of the metrics (adjusted for variability, none in a loss system)
+//   - above one, the average occupancy does not fit in memory (risk of running out of memory, or of preemption)
+func (qa *QueueAnalyzer) MemoryUtilization(budgetBytes float32, perTokenBytes float32) (float32, error) {
+	if budgetBytes <= 0 || perTokenBytes <= 0 {
+		return 0, fmt.Errorf("invalid memory budget %v or footprint per token %v", budgetBytes, perTokenBytes)
+	}
+	model := qa.Model
+	if !model.IsValid() {
+		return 0, fmt.Errorf("model not solved %s", model)
+	}
+	numRequests := model.GetAvgNumInServers() + model.GetAvgQueueLength()*qa.waitScale()
+	tokens := qa.RequestSize.AvgInputTokens + qa.RequestSize.AvgOutputTokens
+	return numRequests * tokens * perTokenBytes / budgetBytes, nil
 }
 
 // calculate effective average number of requests in service (n), given average request service time
 //   - n has to satisfy: prefillTime(n) + totalDecodeTime(n) = avgServiceTime
 //   - prefillTime(n) = gamma + delta * inTokens * n
-//   - totalDecodeTime(n) = (alpha + beta * n) * (outTokens - 1)
-func EffectiveConcurrency(avgServiceTime float32, serviceParms *ServiceParms, requestSize *RequestSize, maxBatchSize int) float32 {
-	tokens := float32(requestSize.AvgOutputTokens - 1)
-	numerator := avgServiceTime - (serviceParms.Prefill.Gamma + serviceParms.Decode.Alpha*tokens)
-	denominator := (serviceParms.Prefill.Delta * float32(requestSize.AvgInputTokens)) + (serviceParms.Decode.Beta * tokens)
-	n := numerator / denominator
-	return min(max(n, 0), float32(maxBatchSize))
+//   - chunked prefillTime(n) = gamma + delta * inTokens + chunks * (alpha + beta * n)
+//   - no prefill (not even gamma) if there are no input tokens
+//   - totalDecodeTime(n) = ((alpha + beta * n) / speedup + positionSlope * outTokens / 2) * (outTokens - 1)
+//   - speedup is the expected number of tokens per forward pass of speculative decoding (one if not speculative)
+//   - piecewise-linear decode time: service time increases with n, solved within the first segment reaching avgServiceTime
+//   - alternative timing models: service time is assumed to increase with n, solved numerically
+//   - n is clamped to [0, maxBatchSize], an error is returned if service time (hardly) depends on n (degenerate parameters,
+//     e.g. delta = beta = 0), or n is not finite
+func EffectiveConcurrency(avgServiceTime float32, serviceParms *ServiceParms, requestSize *RequestSize, maxBatchSize int) (float32, error) {
+	if serviceParms.pluggable() {
+		return concurrencyNumeric(avgServiceTime, serviceParms, requestSize, maxBatchSize)
+	}
+	decode := serviceParms.Decode
+	var n float32
+	var ok bool
+	for i := 0; i < max(len(decode.Breakpoints), 1); i++ {
+		alpha, beta := decode.segment(i)
+		n, ok = concurrencyLinear(avgServiceTime, serviceParms, requestSize, alpha, beta, maxBatchSize)
+		if i+1 >= len(decode.Breakpoints) || ok && n < decode.Breakpoints[i+1] {
+			break
+		}
+	}
+	if !ok {
+		return 0, fmt.Errorf("service time %v does not depend on batch size, degenerate service parameters %s", avgServiceTime, serviceParms)
+	}
+	if math.IsNaN(float64(n)) || math.IsInf(float64(n), 0) {
+		return 0, fmt.Errorf("invalid effective concurrency %v, service time %v, service parameters %s", n, avgServiceTime, serviceParms)
+	}
+	return min(max(n, 0), float32(maxBatchSize)), nil
+}
+
+// solve for the average number of requests in service by bisection over [0, maxBatchSize], given service time increasing with n
+func concurrencyNumeric(avgServiceTime float32, serviceParms *ServiceParms, requestSize *RequestSize, maxBatchSize int) (float32, error) {
+	serviceTime := func(n float32) float32 {
+		return ServiceTime(serviceParms, requestSize.AvgInputTokens, requestSize.AvgOutputTokens, n)
+	}
+	low, high := float32(0), float32(maxBatchSize)
+	timeLow, timeHigh := serviceTime(low), serviceTime(high)
+	switch {
+	case timeHigh-timeLow <= serviceRateTolerance*avgServiceTime:
+		return 0, fmt.Errorf("service time %v does not depend on batch size, degenerate service time models %s", avgServiceTime, serviceParms)
+	case avgServiceTime <= timeLow:
+		return low, nil
+	case avgServiceTime >= timeHigh:
+		return high, nil
+	}
+	for range maxConcurrencyIterations {
+		mid := (low + high) / 2
+		if serviceTime(mid) < avgServiceTime {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, nil
+}
+
+// solve for the average number of requests in service given a linear decode time (alpha + beta * n),
+// false if service time changes by less than a relative tolerance over batch sizes up to max
+func concurrencyLinear(avgServiceTime float32, serviceParms *ServiceParms, requestSize *RequestSize,
+	alpha float32, beta float32, maxBatchSize int) (float32, bool) {
+	prefill := serviceParms.Prefill
+	tokens := (requestSize.AvgOutputTokens - 1) / serviceParms.decodeSpeedup()
+	inTokens := prefill.uncachedTokens(requestSize.AvgInputTokens)
+	base := alpha * tokens
+	slope := prefill.Delta*inTokens + beta*tokens
+	base += serviceParms.positionTime(requestSize.AvgOutputTokens) * (requestSize.AvgOutputTokens - 1)
+	if requestSize.AvgInputTokens > 0 {
+		base += prefill.Gamma
+	}
+	if chunks := prefill.NumChunks(inTokens); chunks > 0 {
+		base += prefill.Delta*inTokens + chunks*alpha
+		slope += chunks*beta - prefill.Delta*inTokens
+	}
+	numerator := avgServiceTime - base
+	denominator := slope
+	if denominator*float32(maxBatchSize) <= serviceRateTolerance*avgServiceTime {
+		return 0, false
+	}
+	return numerator / denominator, true
 }
@@ -0,0 +1,689 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// configuration of a representative server, fixed across tests
+func testConfig(maxBatchSize int, maxQueueSize int) *Configuration {
+	return &Configuration{
+		MaxBatchSize: maxBatchSize,
+		MaxQueueSize: maxQueueSize,
+		ServiceParms: &ServiceParms{
+			Prefill: &PrefillParms{Gamma: 86.615, Delta: 1.446e-03},
+			Decode:  &DecodeParms{Alpha: 6.958, Beta: 0.042},
+		},
+	}
+}
+
+// analyzer of a configuration and request size, failing the test if it cannot be created
+func newTestAnalyzer(tb testing.TB, config *Configuration, requestSize *RequestSize) *QueueAnalyzer {
+	tb.Helper()
+	qa, err := NewQueueAnalyzer(config, requestSize)
+	if err != nil {
+		tb.Fatalf("failed to create analyzer: %v", err)
+	}
+	return qa
+}
+
+// sizing differently-configured analyzers concurrently gives the same results as sizing them one at a time
+// (run with -race to detect shared state)
+func TestSizeConcurrent(t *testing.T) {
+	const numAnalyzers = 50
+	targetPerf := &TargetPerf{TargetTTFT: 500, TargetITL: 12, TargetTPS: 300}
+	newAnalyzer := func(i int) *QueueAnalyzer {
+		return newTestAnalyzer(t, testConfig(8+4*i, 50+i), NewRequestSize(64+16*i, 256+8*i))
+	}
+
+	expected := make([]*TargetRate, numAnalyzers)
+	for i := range expected {
+		targetRate, _, _, err := newAnalyzer(i).Size(targetPerf)
+		if err != nil {
+			t.Fatalf("analyzer %d: %v", i, err)
+		}
+		expected[i] = targetRate
+	}
+
+	actual := make([]*TargetRate, numAnalyzers)
+	errs := make([]error, numAnalyzers)
+	analyzers := make([]*QueueAnalyzer, numAnalyzers)
+	for i := range analyzers {
+		analyzers[i] = newAnalyzer(i)
+	}
+	var wg sync.WaitGroup
+	for i := range numAnalyzers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actual[i], _, _, errs[i] = analyzers[i].Size(targetPerf)
+		}()
+	}
+	wg.Wait()
+
+	for i := range numAnalyzers {
+		if errs[i] != nil {
+			t.Errorf("analyzer %d: %v", i, errs[i])
+			continue
+		}
+		if *actual[i] != *expected[i] {
+			t.Errorf("analyzer %d: concurrent sizing %s, expected %s", i, actual[i], expected[i])
+		}
+	}
+}
+
+// a clone is solved independently of its original, and keeps its parameters and moments of service time when the
+// original is changed
+func TestCloneIndependent(t *testing.T) {
+	config := testConfig(64, 100)
+	multiClass, err := NewMultiClassAnalyzer(config, []*WorkloadClass{
+		{Name: "short", RequestSize: NewRequestSize(64, 128), ArrivalFraction: 3},
+		{Name: "long", RequestSize: NewRequestSize(1024, 512), ArrivalFraction: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create multi-class analyzer: %v", err)
+	}
+	tests := []struct {
+		name     string
+		analyzer *QueueAnalyzer
+		mutate   func(qa *QueueAnalyzer)
+	}{
+		{"single class", newTestAnalyzer(t, config, NewRequestSize(128, 512)), func(qa *QueueAnalyzer) {
+			qa.RequestSize.AvgOutputTokens *= 2
+		}},
+		{"multi-class", multiClass.QueueAnalyzer, func(qa *QueueAnalyzer) {
+			qa.classes[1].RequestSize.AvgInputTokens *= 2
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.analyzer
+			if _, err := original.Analyze(original.RateRange.Max / 4); err != nil {
+				t.Fatalf("failed to analyze original: %v", err)
+			}
+			originalRespTime := original.Model.GetAvgRespTime()
+
+			clone := original.Clone()
+			cloneMetrics, err := clone.Analyze(original.RateRange.Max / 2)
+			if err != nil {
+				t.Fatalf("failed to analyze clone: %v", err)
+			}
+			if respTime := original.Model.GetAvgRespTime(); respTime != originalRespTime {
+				t.Errorf("solving clone changed response time of original to %v, expected %v", respTime, originalRespTime)
+			}
+
+			batchSize := float32(original.MaxBatchSize)
+			cloneServTime, _ := clone.serviceMoments()(batchSize)
+			tt.mutate(original)
+			original.ServiceParms.Decode.Beta *= 2
+			if servTime, _ := original.serviceMoments()(batchSize); servTime == cloneServTime {
+				t.Fatalf("changing original left its service time unchanged at %v", servTime)
+			}
+			if servTime, _ := clone.serviceMoments()(batchSize); servTime != cloneServTime {
+				t.Errorf("changing original changed service time of clone to %v, expected %v", servTime, cloneServTime)
+			}
+			metrics, err := clone.Analyze(original.RateRange.Max / 2)
+			if err != nil {
+				t.Fatalf("failed to analyze clone: %v", err)
+			}
+			if *metrics != *cloneMetrics {
+				t.Errorf("changing original changed metrics of clone to %s, expected %s", metrics, cloneMetrics)
+			}
+		})
+	}
+}
+
+// decode time model quadratic in batch size
+type quadraticDecode struct{ alpha, beta float32 }
+
+func (d quadraticDecode) DecodeTime(batchSize float32) float32 {
+	return d.alpha + d.beta*batchSize*batchSize
+}
+
+// configurations whose service rate decreases with batch size (decode time growing faster than linearly with a large
+// Beta) are rejected, rather than building a model with a bogus range of request rates
+func TestServiceRateInverted(t *testing.T) {
+	steep := testConfig(64, 100)
+	steep.ServiceParms.Decode = &DecodeParms{Alpha: 6.958, Breakpoints: []float32{0, 16}, Slopes: []float32{0.042, 100}}
+	quadratic := testConfig(64, 100)
+	quadratic.ServiceParms.DecodeModel = quadraticDecode{alpha: 6.958, beta: 10}
+	largeBeta := testConfig(64, 100)
+	largeBeta.ServiceParms.Decode.Beta = 100
+
+	tests := []struct {
+		name     string
+		config   *Configuration
+		inverted bool
+	}{
+		{"linear", testConfig(64, 100), false},
+		{"linear large beta", largeBeta, false},
+		{"piecewise large beta", steep, true},
+		{"quadratic", quadratic, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qa, err := NewQueueAnalyzer(tt.config, NewRequestSize(128, 512))
+			if !tt.inverted {
+				if err != nil {
+					t.Fatalf("failed to create analyzer: %v", err)
+				}
+				servRate := qa.Model.GetServiceRates()
+				if maxRate := servRate[len(servRate)-1]; maxRate < servRate[0] {
+					t.Errorf("service rate %v at max batch size below %v at batch size 1", maxRate, servRate[0])
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("inverted service rate accepted with rate range %s", qa.RateRange)
+			}
+			if !strings.Contains(err.Error(), "service rate decreases") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// number of model solutions (evaluated request rates) of sizing for targets, given a hint, and the sized rates
+func countSizeSolves(tb testing.TB, qa *QueueAnalyzer, targetPerf *TargetPerf, hint *TargetRate) (int, *TargetRate) {
+	tb.Helper()
+	solves := 0
+	options := &SizeOptions{Hint: hint, Trace: func(string, float32, float32) { solves++ }}
+	targetRate, _, _, err := qa.SizeWithOptions(context.Background(), targetPerf, options)
+	if err != nil {
+		tb.Fatalf("failed to size: %v", err)
+	}
+	return solves, targetRate
+}
+
+// sizing for slowly changing targets solves the model fewer times when warm started from the previous rates, and
+// converges to the same rates when the hint is good, stale, or out of range
+func TestSizeHint(t *testing.T) {
+	qa := newTestAnalyzer(t, testConfig(256, 100), NewRequestSize(128, 512))
+	previous := &TargetPerf{TargetTTFT: 500, TargetITL: 12}
+	_, previousRate := countSizeSolves(t, qa, previous, nil)
+	targetPerf := &TargetPerf{TargetTTFT: 505, TargetITL: 12.1}
+	coldSolves, expected := countSizeSolves(t, qa, targetPerf, nil)
+
+	tests := []struct {
+		name   string
+		hint   *TargetRate
+		faster bool
+	}{
+		{"previous rates", previousRate, true},
+		{"stale rates", &TargetRate{RateTargetTTFT: previousRate.RateTargetTTFT / 4, RateTargetITL: previousRate.RateTargetITL / 4}, false},
+		{"out of range", &TargetRate{RateTargetTTFT: 10 * qa.RateRange.Max, RateTargetITL: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solves, targetRate := countSizeSolves(t, qa, targetPerf, tt.hint)
+			if tt.faster && solves >= coldSolves {
+				t.Errorf("%d solves with hint, not fewer than %d without", solves, coldSolves)
+			}
+			for _, rates := range [][2]float32{
+				{targetRate.RateTargetTTFT, expected.RateTargetTTFT},
+				{targetRate.RateTargetITL, expected.RateTargetITL},
+			} {
+				if math.Abs(float64(rates[0]-rates[1])) > 1e-3*float64(rates[1]) {
+					t.Errorf("sized rates %s with hint, expected %s", targetRate, expected)
+				}
+			}
+		})
+	}
+}
+
+// sizing for slowly changing targets, with and without a hint of the previous rates, reporting model solutions per
+// sizing (solves/op)
+func BenchmarkSizeHint(b *testing.B) {
+	qa := newTestAnalyzer(b, testConfig(256, 100), NewRequestSize(128, 512))
+	_, previousRate := countSizeSolves(b, qa, &TargetPerf{TargetTTFT: 500, TargetITL: 12}, nil)
+	targetPerf := &TargetPerf{TargetTTFT: 505, TargetITL: 12.1}
+	for _, bm := range []struct {
+		name string
+		hint *TargetRate
+	}{
+		{"no hint", nil},
+		{"hint", previousRate},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			solves := 0
+			for range b.N {
+				n, _ := countSizeSolves(b, qa, targetPerf, bm.hint)
+				solves += n
+			}
+			b.ReportMetric(float64(solves)/float64(b.N), "solves/op")
+		})
+	}
+}
+
+// average queue length per replica is consistent with average waiting time by Little's law, with throughput
+// (requests/sec) over all replicas and times in msec
+func TestLittlesLaw(t *testing.T) {
+	replicated := testConfig(64, 100)
+	replicated.Replicas = 3
+	variable := testConfig(64, 100)
+	variable.ArrivalSCV = 2
+	tests := []struct {
+		name        string
+		config      *Configuration
+		requestSize *RequestSize
+	}{
+		{"single replica", testConfig(64, 100), NewRequestSize(128, 512)},
+		{"replicas", replicated, NewRequestSize(128, 512)},
+		{"variable arrivals and sizes", variable, &RequestSize{AvgInputTokens: 150, AvgOutputTokens: 300,
+			Distribution: []*SizeBucket{{100, 100, 1}, {200, 500, 1}}}},
+		{"small queue", testConfig(16, 4), NewRequestSize(1024, 128)},
+	}
+	for _, tt := range tests {
+		qa := newTestAnalyzer(t, tt.config, tt.requestSize)
+		for _, fraction := range []float32{0.2, 0.5, 0.8, 0.95} {
+			t.Run(fmt.Sprintf("%s at %v of max rate", tt.name, fraction), func(t *testing.T) {
+				metrics, err := qa.Analyze(fraction * qa.RateRange.Max)
+				if err != nil {
+					t.Fatalf("failed to analyze: %v", err)
+				}
+				expected := metrics.AvgWaitTime * metrics.Throughput / 1000 / float32(qa.Replicas)
+				if diff := math.Abs(float64(metrics.AvgQueueLength - expected)); diff > 1e-3*max(1, float64(expected)) {
+					t.Errorf("average queue length %v, expected %v (wait time %v, throughput %v)",
+						metrics.AvgQueueLength, expected, metrics.AvgWaitTime, metrics.Throughput)
+				}
+			})
+		}
+	}
+}
+
+// sweeping the acceptance rate of speculative decoding from 0 to 1 improves ITL monotonically at a fixed request rate,
+// and raises the max rate, without speedup at zero acceptance
+func TestSpeculativeAcceptanceSweep(t *testing.T) {
+	requestSize := NewRequestSize(128, 512)
+	baseline, err := newTestAnalyzer(t, testConfig(64, 100), requestSize).Analyze(6)
+	if err != nil {
+		t.Fatalf("failed to analyze without speculative decoding: %v", err)
+	}
+	for _, draftLength := range []int{1, 4, 8} {
+		t.Run(fmt.Sprintf("draft length %d", draftLength), func(t *testing.T) {
+			var previous *AnalysisMetrics
+			for i := 0; i <= 10; i++ {
+				acceptanceRate := float32(i) / 10
+				config := testConfig(64, 100)
+				config.ServiceParms.Speculative = &SpeculativeParms{AcceptanceRate: acceptanceRate, DraftLength: draftLength}
+				metrics, err := newTestAnalyzer(t, config, requestSize).Analyze(6)
+				if err != nil {
+					t.Fatalf("acceptance rate %v: failed to analyze: %v", acceptanceRate, err)
+				}
+				if math.IsNaN(float64(metrics.AvgTokenTime)) || metrics.AvgTokenTime <= 0 {
+					t.Fatalf("acceptance rate %v: invalid ITL %v", acceptanceRate, metrics.AvgTokenTime)
+				}
+				if previous == nil {
+					if !metrics.ApproxEqual(baseline, 1e-5) {
+						t.Errorf("zero acceptance rate: metrics %s, expected as without speculative decoding %s", metrics, baseline)
+					}
+					previous = metrics
+					continue
+				}
+				if metrics.AvgTokenTime >= previous.AvgTokenTime {
+					t.Errorf("acceptance rate %v: ITL %v, not below %v at acceptance rate %v",
+						acceptanceRate, metrics.AvgTokenTime, previous.AvgTokenTime, acceptanceRate-0.1)
+				}
+				if metrics.MaxRate < previous.MaxRate {
+					t.Errorf("acceptance rate %v: max rate %v, below %v at acceptance rate %v",
+						acceptanceRate, metrics.MaxRate, previous.MaxRate, acceptanceRate-0.1)
+				}
+				previous = metrics
+			}
+		})
+	}
+}
+
+// requests without input tokens (pure decode) give finite metrics, without prefill time, over a finite range of
+// request rates, with latencies not decreasing as the request rate increases
+func TestNoInputTokens(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Configuration
+		requestSize *RequestSize
+	}{
+		{"long output", testConfig(64, 100), NewRequestSize(0, 512)},
+		{"short output", testConfig(64, 100), NewRequestSize(0, 16)},
+		{"no queue", testConfig(8, 0), NewRequestSize(0, 128)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qa := newTestAnalyzer(t, tt.config, tt.requestSize)
+			rateRange := qa.RateRange
+			if !(rateRange.Min > 0 && rateRange.Min < rateRange.Max) || math.IsInf(float64(rateRange.Max), 0) {
+				t.Fatalf("invalid rate range %s", rateRange)
+			}
+			// decreasing beyond rounding, relative to the value and absolute (msec) near zero waiting time
+			decreased := func(value, previous float32) bool {
+				return value < previous*(1-1e-5)-1e-6
+			}
+			var previous *AnalysisMetrics
+			for i := 1; i <= 20; i++ {
+				requestRate := rateRange.Max * float32(i) / 20
+				metrics, err := qa.Analyze(requestRate)
+				if err != nil {
+					t.Fatalf("rate %v: failed to analyze: %v", requestRate, err)
+				}
+				for name, value := range map[string]float32{"TTFT": metrics.AvgTTFT, "ITL": metrics.AvgTokenTime,
+					"response time": metrics.AvgRespTime, "waiting time": metrics.AvgWaitTime, "throughput": metrics.Throughput} {
+					if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) || value < 0 {
+						t.Fatalf("rate %v: invalid %s %v", requestRate, name, value)
+					}
+				}
+				if metrics.AvgPrefillTime != 0 {
+					t.Errorf("rate %v: prefill time %v without input tokens", requestRate, metrics.AvgPrefillTime)
+				}
+				if previous != nil && (decreased(metrics.AvgTTFT, previous.AvgTTFT) || decreased(metrics.AvgTokenTime, previous.AvgTokenTime) ||
+					decreased(metrics.AvgRespTime, previous.AvgRespTime) || metrics.Throughput < previous.Throughput) {
+					t.Errorf("rate %v: metrics %s not monotonic from %s", requestRate, metrics, previous)
+				}
+				previous = metrics
+			}
+		})
+	}
+}
+
+// decode time model constant in batch size
+type constantDecode float32
+
+func (d constantDecode) DecodeTime(float32) float32 {
+	return float32(d)
+}
+
+// effective concurrency of service parameters whose service time does not depend on batch size (e.g. Delta = Beta = 0)
+// is an error, rather than a clamped value, surfacing through the analyzer
+func TestEffectiveConcurrencyDegenerate(t *testing.T) {
+	requestSize := NewRequestSize(128, 512)
+	flat := &ServiceParms{Prefill: &PrefillParms{Gamma: 86.615}, Decode: &DecodeParms{Alpha: 6.958}}
+	tests := []struct {
+		name       string
+		parms      *ServiceParms
+		degenerate bool
+	}{
+		{"linear", testConfig(64, 100).ServiceParms, false},
+		{"zero delta and beta", flat, true},
+		{"zero delta and slopes", &ServiceParms{Prefill: &PrefillParms{Gamma: 86.615},
+			Decode: &DecodeParms{Alpha: 6.958, Breakpoints: []float32{0, 16}, Slopes: []float32{0, 0}}}, true},
+		{"constant decode model", &ServiceParms{Prefill: &PrefillParms{Gamma: 86.615}, DecodeModel: constantDecode(6.958)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servTime := ServiceTime(tt.parms, requestSize.AvgInputTokens, requestSize.AvgOutputTokens, 8)
+			n, err := EffectiveConcurrency(servTime, tt.parms, requestSize, 64)
+			if !tt.degenerate {
+				if err != nil || math.Abs(float64(n-8)) > 1e-3 {
+					t.Errorf("effective concurrency %v, error %v, expected 8", n, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("effective concurrency %v of degenerate parameters without error", n)
+			}
+			config := testConfig(64, 100)
+			config.ServiceParms = tt.parms
+			if qa, err := NewQueueAnalyzer(config, requestSize); err == nil {
+				if metrics, err := qa.Analyze(qa.RateRange.Max / 2); err == nil {
+					t.Errorf("analysis of degenerate parameters without error: %s", metrics)
+				}
+			}
+		})
+	}
+}
+
+// marginal response time is evaluated at rates within the rate range, including its ends, and rejected outside it
+func TestMarginalRespTimeRange(t *testing.T) {
+	qa := newTestAnalyzer(t, testConfig(64, 100), NewRequestSize(128, 512))
+	rateRange := qa.RateRange
+	tests := []struct {
+		name        string
+		requestRate float32
+		valid       bool
+	}{
+		{"zero", 0, false},
+		{"below min", rateRange.Min / 2, false},
+		{"min", rateRange.Min, true},
+		{"middle", (rateRange.Min + rateRange.Max) / 2, true},
+		{"max", rateRange.Max, true},
+		{"above max", rateRange.Max * 1.01, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marginal, err := qa.MarginalRespTime(tt.requestRate)
+			if !tt.valid {
+				if err == nil || !strings.Contains(err.Error(), "allowed range") {
+					t.Errorf("rate %v outside range %s: marginal response time %v, error %v", tt.requestRate, rateRange, marginal, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rate %v: %v", tt.requestRate, err)
+			}
+			if marginal <= 0 || math.IsInf(float64(marginal), 0) {
+				t.Errorf("rate %v: invalid marginal response time %v", tt.requestRate, marginal)
+			}
+		})
+	}
+}
+
+// a loss system (no queue) reports exactly zero waiting time at all rates, excess load blocked
+func TestLossSystemNoWait(t *testing.T) {
+	lossOnly := testConfig(64, 100)
+	lossOnly.LossOnly = true
+	replicated := testConfig(16, 0)
+	replicated.Replicas = 2
+	tests := []struct {
+		name   string
+		config *Configuration
+	}{
+		{"small batch", testConfig(8, 0)},
+		{"large batch", testConfig(64, 0)},
+		{"loss only", lossOnly},
+		{"replicas", replicated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qa := newTestAnalyzer(t, tt.config, NewRequestSize(128, 512))
+			for i := 1; i <= 20; i++ {
+				requestRate := qa.RateRange.Max * float32(i) / 20
+				metrics, err := qa.Analyze(requestRate)
+				if err != nil {
+					t.Fatalf("rate %v: failed to analyze: %v", requestRate, err)
+				}
+				if metrics.AvgWaitTime != 0 || metrics.AvgQueueLength != 0 || metrics.AvgTTFT != metrics.AvgPrefillTime {
+					t.Errorf("rate %v: waiting in a loss system: %s", requestRate, metrics)
+				}
+				if diff := math.Abs(float64(metrics.Throughput + metrics.DropRate - requestRate)); diff > 1e-4*float64(requestRate) {
+					t.Errorf("rate %v: throughput %v and drop rate %v do not add up to the offered rate",
+						requestRate, metrics.Throughput, metrics.DropRate)
+				}
+			}
+			metrics, err := qa.Analyze(qa.RateRange.Max)
+			if err != nil {
+				t.Fatalf("failed to analyze at max rate: %v", err)
+			}
+			if metrics.PBlock <= 0 {
+				t.Errorf("no blocking at max rate: %s", metrics)
+			}
+		})
+	}
+}
+
+// analysis across occupancy sizes (max batch and queue sizes) at half the max rate
+func BenchmarkAnalyze(b *testing.B) {
+	for _, size := range [][2]int{{8, 8}, {64, 64}, {256, 100}, {1024, 1024}} {
+		b.Run(fmt.Sprintf("maxBatch=%d/maxQueue=%d", size[0], size[1]), func(b *testing.B) {
+			qa := newTestAnalyzer(b, testConfig(size[0], size[1]), NewRequestSize(128, 512))
+			requestRate := qa.RateRange.Max / 2
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := qa.Analyze(requestRate); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// sizing across target tightness, TTFT and ITL targets a multiple of the metrics at zero load
+func BenchmarkSize(b *testing.B) {
+	for _, tightness := range []float32{1.05, 1.5, 3, 10} {
+		b.Run(fmt.Sprintf("targets=%vx", tightness), func(b *testing.B) {
+			qa := newTestAnalyzer(b, testConfig(256, 100), NewRequestSize(128, 512))
+			baseline := qa.Baseline()
+			targetPerf := &TargetPerf{TargetTTFT: baseline.AvgTTFT * tightness, TargetITL: baseline.AvgTokenTime * tightness}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, _, _, err := qa.Size(targetPerf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// prefill of requests whose input tokens are all found in the prompt cache takes the base prefill time (Gamma) only,
+// and caching more input tokens shortens prefill and raises the max rate
+func TestCacheHitRate(t *testing.T) {
+	var previous *AnalysisMetrics
+	for _, hitRate := range []float32{0, 0.25, 0.5, 0.75, 1} {
+		t.Run(fmt.Sprintf("hit rate %v", hitRate), func(t *testing.T) {
+			config := testConfig(64, 100)
+			config.ServiceParms.Prefill.CacheHitRate = hitRate
+			qa := newTestAnalyzer(t, config, NewRequestSize(2048, 256))
+			metrics, err := qa.Analyze(qa.RateRange.Max / 2)
+			if err != nil {
+				t.Fatalf("failed to analyze: %v", err)
+			}
+			prefill := config.ServiceParms.Prefill
+			expected := prefill.Gamma + prefill.Delta*2048*(1-hitRate)*metrics.EffConc
+			if diff := math.Abs(float64(metrics.AvgPrefillTime - expected)); diff > 1e-4*float64(expected) {
+				t.Errorf("prefill time %v, expected %v", metrics.AvgPrefillTime, expected)
+			}
+			if hitRate == 1 && metrics.AvgPrefillTime != prefill.Gamma {
+				t.Errorf("prefill time %v with all input tokens cached, expected gamma %v", metrics.AvgPrefillTime, prefill.Gamma)
+			}
+			if previous != nil && metrics.MaxRate <= previous.MaxRate {
+				t.Errorf("max rate %v, not above %v at a lower hit rate", metrics.MaxRate, previous.MaxRate)
+			}
+			previous = metrics
+		})
+	}
+}
+
+// memory utilization counts the requests in service and in queue of the metrics at the operating point
+func TestMemoryUtilization(t *testing.T) {
+	const budgetBytes, perTokenBytes = 40e9, 160e3
+	variable := testConfig(64, 100)
+	variable.ArrivalSCV = 3
+	lossOnly := testConfig(64, 100)
+	lossOnly.LossOnly = true
+	tests := []struct {
+		name        string
+		config      *Configuration
+		requestSize *RequestSize
+	}{
+		{"poisson", testConfig(64, 100), NewRequestSize(128, 512)},
+		{"variable arrivals", variable, NewRequestSize(128, 512)},
+		{"size distribution", testConfig(64, 100), &RequestSize{AvgInputTokens: 150, AvgOutputTokens: 300,
+			Distribution: []*SizeBucket{{100, 100, 1}, {200, 500, 1}}}},
+		{"loss only", lossOnly, NewRequestSize(128, 512)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qa := newTestAnalyzer(t, tt.config, tt.requestSize)
+			metrics, err := qa.Analyze(0.9 * qa.RateRange.Max)
+			if err != nil {
+				t.Fatalf("failed to analyze: %v", err)
+			}
+			utilization, err := qa.MemoryUtilization(budgetBytes, perTokenBytes)
+			if err != nil {
+				t.Fatalf("failed to evaluate memory utilization: %v", err)
+			}
+			tokens := tt.requestSize.AvgInputTokens + tt.requestSize.AvgOutputTokens
+			expected := (metrics.AvgNumInServ + metrics.AvgQueueLength) * tokens * perTokenBytes / budgetBytes
+			if diff := math.Abs(float64(utilization - expected)); diff > 1e-5*float64(expected) {
+				t.Errorf("memory utilization %v, expected %v for metrics %s", utilization, expected, metrics)
+			}
+		})
+	}
+}
+
+// rates below the min rate are idle, the min rate is not (even after a round trip through requests/msec), and the
+// model is left solved for evaluations at its operating point
+func TestIdleRates(t *testing.T) {
+	qa := newTestAnalyzer(t, testConfig(64, 100), NewRequestSize(128, 512))
+	rateRange := qa.RateRange
+	tests := []struct {
+		name    string
+		analyze func() (*AnalysisMetrics, error)
+		idle    bool
+	}{
+		{"below min", func() (*AnalysisMetrics, error) { return qa.Analyze(rateRange.Min / 2) }, true},
+		{"just below min", func() (*AnalysisMetrics, error) { return qa.Analyze(rateRange.Min * 0.999) }, true},
+		{"min", func() (*AnalysisMetrics, error) { return qa.Analyze(rateRange.Min) }, false},
+		{"min per msec", func() (*AnalysisMetrics, error) { return qa.AnalyzeRate(rateRange.Min / 1000) }, false},
+		{"middle", func() (*AnalysisMetrics, error) { return qa.Analyze(rateRange.Max / 2) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := tt.analyze()
+			if err != nil {
+				t.Fatalf("failed to analyze: %v", err)
+			}
+			if metrics.Idle != tt.idle {
+				t.Errorf("idle %v, expected %v: %s", metrics.Idle, tt.idle, metrics)
+			}
+			if _, err := qa.MemoryUtilization(40e9, 160e3); err != nil {
+				t.Errorf("failed to evaluate memory utilization: %v", err)
+			}
+			if _, err := qa.ServiceTimeCDF(); err != nil {
+				t.Errorf("failed to evaluate service time distribution: %v", err)
+			}
+		})
+	}
+}
+
+// updates at an unchanged rate reflect changes to the analyzer (cost, replicas), and leave the model solved at the
+// rate of the update, even after analysis at another rate
+func TestUpdateUnchangedRate(t *testing.T) {
+	qa := newTestAnalyzer(t, testConfig(64, 100), NewRequestSize(128, 512))
+	rate := qa.RateRange.Max / 4
+	update := func() *AnalysisMetrics {
+		t.Helper()
+		metrics, err := qa.Update(rate)
+		if err != nil {
+			t.Fatalf("failed to update at rate %v: %v", rate, err)
+		}
+		if solved := qa.Model.GetLambdaPerSecond() * float32(qa.Replicas); math.Abs(float64(solved-rate)) > 1e-6*float64(rate) {
+			t.Errorf("model solved at rate %v after update at rate %v", solved, rate)
+		}
+		return metrics
+	}
+	first := update()
+
+	if _, err := qa.Analyze(qa.RateRange.Max / 2); err != nil {
+		t.Fatalf("failed to analyze: %v", err)
+	}
+	if again := update(); !reflect.DeepEqual(again, first) {
+		t.Errorf("update after analysis at another rate gives %s, expected %s", again, first)
+	}
+
+	qa.CostPerSecond = 0.002
+	if metrics := update(); metrics.CostPerMillionTokens == first.CostPerMillionTokens {
+		t.Errorf("update after a cost change gives the same cost %v", metrics.CostPerMillionTokens)
+	}
+
+	qa.Replicas = 2
+	if metrics := update(); metrics.AvgRespTime >= first.AvgRespTime {
+		t.Errorf("update with the rate split over two replicas gives response time %v, expected below %v",
+			metrics.AvgRespTime, first.AvgRespTime)
+	}
+}
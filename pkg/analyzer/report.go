@@ -0,0 +1,103 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// format performance metrics as an aligned table of labeled values with units, for CLI output and logs
+//   - rows of targeted metrics (TTFT, ITL) are flagged as met or missed (target may be nil)
+//   - a target TPS is not checked, as token throughput depends on the number of output tokens per request (see Report)
+//   - costs are reported only if considered
+func FormatReport(metrics *AnalysisMetrics, target *TargetPerf) string {
+	return formatReport(metrics, target, nil)
+}
+
+// same as FormatReport, with the token throughput of the server (tokens/sec), the throughput times the average number
+// of output tokens of the analyzer, reported and checked against a target TPS, as in sizing
+func (qa *QueueAnalyzer) Report(metrics *AnalysisMetrics, target *TargetPerf) string {
+	if metrics == nil {
+		return formatReport(nil, target, nil)
+	}
+	tokenThroughput := qa.achievedPerf(metrics).TargetTPS
+	return formatReport(metrics, target, &tokenThroughput)
+}
+
+// format performance metrics, with the token throughput (tokens/sec) checked against a target TPS if given (not nil)
+func formatReport(metrics *AnalysisMetrics, target *TargetPerf, tokenThroughput *float32) string {
+	if metrics == nil {
+		return "no metrics\n"
+	}
+	if target == nil {
+		target = &TargetPerf{}
+	}
+
+	// rows of label, value, unit, and target status
+	var rows [][]string
+	add := func(label string, value string, unit string, status string) {
+		rows = append(rows, []string{label + ":", value, unit, status})
+	}
+	// status of a value against a target, met if at most the target (at least if higher is better), empty if no target
+	status := func(value float32, unit string, targetValue float32, higherIsBetter bool) string {
+		if targetValue <= 0 {
+			return ""
+		}
+		met := "missed"
+		if (!higherIsBetter && value <= targetValue) || (higherIsBetter && value >= targetValue) {
+			met = "met"
+		}
+		return fmt.Sprintf("target %.3f %s, %s", targetValue, unit, met)
+	}
+	row := func(label string, value float32, unit string, targetValue float32) {
+		add(label, fmt.Sprintf("%.3f", value), unit, status(value, unit, targetValue, false))
+	}
+	row("Offered rate", metrics.OfferedRate, "req/s", 0)
+	row("Throughput", metrics.Throughput, "req/s", 0)
+	row("Throughput std dev", metrics.ThroughputStdDev, "req/s", 0)
+	row("Goodput", metrics.Goodput, "req/s", 0)
+	row("Drop rate", metrics.DropRate, "req/s", 0)
+	add("Blocking probability", fmt.Sprintf("%.5f", metrics.PBlock), "", "")
+	row("Avg response time", metrics.AvgRespTime, "ms", 0)
+	row("P95 response time", metrics.P95RespTime, "ms", 0)
+	row("P99 response time", metrics.P99RespTime, "ms", 0)
+	row("Avg wait time", metrics.AvgWaitTime, "ms", 0)
+	row("Avg prefill time", metrics.AvgPrefillTime, "ms", 0)
+	row("Avg TTFT", metrics.AvgTTFT, "ms", target.TargetTTFT)
+	row("Avg ITL", metrics.AvgTokenTime, "ms", target.TargetITL)
+	row("P95 ITL", metrics.P95TokenTime, "ms", 0)
+	row("P99 ITL", metrics.P99TokenTime, "ms", 0)
+	row("Avg in service", metrics.AvgNumInServ, "req", 0)
+	row("Avg queue length", metrics.AvgQueueLength, "req", 0)
+	row("Effective concurrency", metrics.EffConc, "req", 0)
+	row("Utilization", metrics.Rho*100, "%", 0)
+	add("Regime", string(metrics.Regime), "", "")
+	add("Idle", strconv.FormatBool(metrics.Idle), "", "")
+	row("Max rate", metrics.MaxRate, "req/s", 0)
+	if metrics.CostPerRequest > 0 {
+		add("Cost per request", fmt.Sprintf("%.5f", metrics.CostPerRequest), "", "")
+		add("Cost per million tokens", fmt.Sprintf("%.3f", metrics.CostPerMillionTokens), "", "")
+	}
+	switch {
+	case tokenThroughput != nil:
+		add("Token throughput", fmt.Sprintf("%.3f", *tokenThroughput), "tokens/s",
+			status(*tokenThroughput, "tokens/s", target.TargetTPS, true))
+	case target.TargetTPS > 0:
+		add("Target TPS", fmt.Sprintf("%.3f", target.TargetTPS), "tokens/s", "not checked")
+	}
+
+	// align columns: labels left, values right
+	widths := make([]int, 3)
+	for _, r := range rows {
+		for i := range widths {
+			widths[i] = max(widths[i], len(r[i]))
+		}
+	}
+	var b strings.Builder
+	for _, r := range rows {
+		line := fmt.Sprintf("%-*s  %*s  %-*s  %s", widths[0], r[0], widths[1], r[1], widths[2], r[2], r[3])
+		b.WriteString(strings.TrimRight(line, " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+// targeted rows of the report are flagged as met or missed, a target TPS not checked without the request size
+func TestFormatReportTargets(t *testing.T) {
+	metrics := &AnalysisMetrics{Throughput: 0.1, AvgTTFT: 200, AvgTokenTime: 10}
+	tests := []struct {
+		name   string
+		target *TargetPerf
+		want   []string
+		absent []string
+	}{
+		{"no target", nil, nil, []string{"target", "TPS", "Token throughput"}},
+		{"met", &TargetPerf{TargetTTFT: 250, TargetITL: 10},
+			[]string{"target 250.000 ms, met", "target 10.000 ms, met"}, []string{"missed", "TPS"}},
+		{"missed", &TargetPerf{TargetTTFT: 150, TargetITL: 8},
+			[]string{"target 150.000 ms, missed", "target 8.000 ms, missed"}, []string{"met", "TPS"}},
+		{"TPS", &TargetPerf{TargetTPS: 100}, []string{"Target TPS:", "not checked"}, []string{"met", "missed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkReport(t, FormatReport(metrics, tt.target), tt.want, tt.absent)
+		})
+	}
+}
+
+// the report of an analyzer checks a target TPS against the token throughput of the server (throughput times output
+// tokens), as in sizing, rather than the token rate of a request
+func TestReportTokenThroughput(t *testing.T) {
+	qa := newTestAnalyzer(t, testConfig(64, 100), NewRequestSize(128, 512))
+	tests := []struct {
+		name       string
+		throughput float32
+		target     *TargetPerf
+		want       []string
+		absent     []string
+	}{
+		{"no target", 1, nil, []string{"Token throughput:", "512.000"}, []string{"target"}},
+		{"low throughput", 0.1, &TargetPerf{TargetTPS: 100}, []string{"51.200", "target 100.000 tokens/s, missed"}, []string{"met"}},
+		{"high throughput", 1, &TargetPerf{TargetTPS: 100}, []string{"512.000", "target 100.000 tokens/s, met"}, []string{"missed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ITL of 10 msec, a token rate of 100 tokens/sec per request, met regardless of throughput
+			metrics := &AnalysisMetrics{Throughput: tt.throughput, AvgTokenTime: 10}
+			report := qa.Report(metrics, tt.target)
+			checkReport(t, report, tt.want, tt.absent)
+			if tt.target != nil {
+				achieved := qa.achievedPerf(metrics)
+				met := strings.Contains(report, "tokens/s, met")
+				if sized := tt.target.isAchieved(achieved); met != sized {
+					t.Errorf("report met %v, sizing achieved %v for %s", met, sized, achieved)
+				}
+			}
+		})
+	}
+}
+
+// check that a report contains strings, and does not contain others
+func checkReport(t *testing.T, report string, want []string, absent []string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(report, s) {
+			t.Errorf("report without %q:\n%s", s, report)
+		}
+	}
+	for _, s := range absent {
+		if strings.Contains(report, s) {
+			t.Errorf("report with %q:\n%s", s, report)
+		}
+	}
+}
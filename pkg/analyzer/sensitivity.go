@@ -0,0 +1,181 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// names of parameters varied in sensitivity analysis
+const (
+	ParamAvgInputTokens  = "AvgInputTokens"
+	ParamAvgOutputTokens = "AvgOutputTokens"
+	ParamMaxBatchSize    = "MaxBatchSize"
+	ParamMaxQueueSize    = "MaxQueueSize"
+	ParamReplicas        = "Replicas"
+)
+
+// evaluate performance metrics at a given request rate for each of a list of values of a named parameter,
+// rebuilding the model (service rates and rate range) for each value
+//   - the analyzer itself is left unchanged
+//   - varying a number of tokens drops the request size distribution, if any, keeping only averages
+//   - integer parameters (batch size, queue size, replicas) are truncated
+func (qa *QueueAnalyzer) Sensitivity(param string, values []float32, requestRate float32) (metricsList []*AnalysisMetrics, err error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values of parameter %s", param)
+	}
+	metricsList = make([]*AnalysisMetrics, len(values))
+	for i, value := range values {
+		config := qa.configuration()
+		requestSize := qa.RequestSize
+		moments := qa.serviceMoments()
+		switch param {
+		case ParamAvgInputTokens, ParamAvgOutputTokens:
+			requestSize = &RequestSize{
+				AvgInputTokens:  qa.RequestSize.AvgInputTokens,
+				AvgOutputTokens: qa.RequestSize.AvgOutputTokens,
+			}
+			if param == ParamAvgInputTokens {
+				requestSize.AvgInputTokens = value
+			} else {
+				requestSize.AvgOutputTokens = value
+			}
+			if err = requestSize.check(); err != nil {
+				return nil, err
+			}
+			moments = singleClassMoments(config.timing(), requestSize)
+		case ParamMaxBatchSize:
+			config.MaxBatchSize = int(value)
+			config.FractionalMaxBatch = 0
+		case ParamMaxQueueSize:
+			config.MaxQueueSize = int(value)
+		case ParamReplicas:
+			config.Replicas = int(value)
+		default:
+			return nil, fmt.Errorf("unknown parameter %s", param)
+		}
+		if err = config.check(); err != nil {
+			return nil, err
+		}
+		if err = checkModel(config, requestSize, moments); err != nil {
+			return nil, fmt.Errorf("%s=%v: %v", param, value, err)
+		}
+		candidate := buildModel(config, requestSize, moments)
+		if metricsList[i], err = candidate.Analyze(requestRate); err != nil {
+			return nil, fmt.Errorf("%s=%v: %v", param, value, err)
+		}
+	}
+	return metricsList, nil
+}
+
+// evaluate performance metrics at a given request rate for each max batch size 1, 2, ..., maxBatch, rebuilding the
+// model for each (e.g. to choose the max batch size of a configuration), returns
+//   - performance metrics aligned with the batch sizes (element i at max batch size i+1), nil for a batch size that failed
+//   - errors of the failed batch sizes joined, nil if none failed, e.g. a RateExceedsMaxError (errors.As) flags the
+//     batch sizes whose max rate is below the request rate, the other batch sizes are still analyzed
+//   - the analyzer itself is left unchanged
+func (qa *QueueAnalyzer) AnalyzeBatchSizes(requestRate float32, maxBatch int) (metricsList []*AnalysisMetrics, err error) {
+	if limit := qa.Options.batchSizeLimit(); maxBatch <= 0 || maxBatch > limit {
+		return nil, fmt.Errorf("invalid max batch size %d, limit %d (analyzer option maxBatchSizeLimit)", maxBatch, limit)
+	}
+	metricsList = make([]*AnalysisMetrics, maxBatch)
+	var errs []error
+	for i := range metricsList {
+		candidate, err := qa.withMaxBatchSize(i + 1)
+		if err == nil {
+			metricsList[i], err = candidate.Analyze(requestRate)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("batch size %d: %w", i+1, err))
+		}
+	}
+	return metricsList, errors.Join(errs...)
+}
+
+// evaluate the max batch size, up to that of the configuration, maximizing the achievable throughput while keeping the
+// average response time within a cap (msec) at a given request rate, returns
+//   - optimal max batch size, the smallest if several achieve the same throughput (within epsilon of the analyzer
+//     options, relative), as the throughput flattens once the max batch size exceeds the concurrency under the cap
+//   - performance metrics at the given request rate with the optimal max batch size
+//   - the achievable throughput of a max batch size is the max request rate keeping the average response time within
+//     the cap (RateForRespTime), candidates are the max batch sizes meeting the cap at the given request rate
+//   - all max batch sizes are scanned, rebuilding and sizing the model for each, as the achievable throughput need not be
+//     unimodal in the max batch size (e.g. limited by the range of request rates at small batch sizes)
+//   - the analyzer itself is left unchanged
+func (qa *QueueAnalyzer) OptimalBatchSize(requestRate float32, latencyCapMs float32) (int, *AnalysisMetrics, error) {
+	if requestRate <= 0 || latencyCapMs <= 0 {
+		return 0, nil, fmt.Errorf("invalid request rate %v or latency cap %v", requestRate, latencyCapMs)
+	}
+	maxBatch := qa.configuration().MaxBatchSize
+	var bestBatch int
+	var bestRate float32
+	var bestMetrics *AnalysisMetrics
+	for b := 1; b <= maxBatch; b++ {
+		candidate, err := qa.withMaxBatchSize(b)
+		if err != nil {
+			return 0, nil, fmt.Errorf("batch size %d: %w", b, err)
+		}
+		metrics, err := candidate.Analyze(requestRate)
+		var rateErr *RateExceedsMaxError
+		if errors.As(err, &rateErr) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("batch size %d: %w", b, err)
+		}
+		if metrics.AvgRespTime > latencyCapMs {
+			continue
+		}
+		rate, _, err := candidate.RateForRespTime(latencyCapMs)
+		if err != nil {
+			return 0, nil, fmt.Errorf("batch size %d: %w", b, err)
+		}
+		if rate > bestRate*(1+qa.Options.Epsilon) {
+			bestBatch, bestRate, bestMetrics = b, rate, metrics
+		}
+	}
+	if bestMetrics == nil {
+		return 0, nil, fmt.Errorf("no max batch size up to %d keeps average response time within %v at rate %v",
+			maxBatch, latencyCapMs, requestRate)
+	}
+	return bestBatch, bestMetrics, nil
+}
+
+// build the model of the configuration of the analyzer with a given (integer) max batch size
+func (qa *QueueAnalyzer) withMaxBatchSize(maxBatchSize int) (*QueueAnalyzer, error) {
+	config := qa.configuration()
+	config.MaxBatchSize = maxBatchSize
+	config.FractionalMaxBatch = 0
+	moments := qa.serviceMoments()
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	if err := checkModel(config, qa.RequestSize, moments); err != nil {
+		return nil, err
+	}
+	candidate := buildModel(config, qa.RequestSize, moments)
+	candidate.classes = qa.classes
+	return candidate, nil
+}
+
+// evaluate performance metrics at a given request rate for each of a list of configurations (e.g. combinations of
+// max batch and queue sizes), building and analyzing a model for each, returns
+//   - performance metrics aligned with the configurations, nil for a configuration that failed
+//   - errors of the failed configurations (e.g. rate above the max rate of a configuration) joined, nil if none failed,
+//     the other configurations are still analyzed
+func CompareConfigs(configs []*Configuration, requestSize *RequestSize, requestRate float32) (metricsList []*AnalysisMetrics, err error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no configurations")
+	}
+	metricsList = make([]*AnalysisMetrics, len(configs))
+	var errs []error
+	for i, config := range configs {
+		candidate, err := NewQueueAnalyzer(config, requestSize)
+		if err == nil {
+			metricsList[i], err = candidate.Analyze(requestRate)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config %d: %w", i, err))
+		}
+	}
+	return metricsList, errors.Join(errs...)
+}
@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// number of bisection iterations when evaluating a quantile of service time
+const maxQuantileIterations = 100
+
+// distribution of request service time at the operating point of the solved model (e.g. after Analyze),
+// a mixture over batch sizes weighted by the stationary probabilities
+//   - departures at batch size b occur at rate P[batch size b] * servRate(b), hence the mean of the mixture is the
+//     average service time of the model (Little's law for the batch)
+//   - service time at batch size b is exponential with mean b / servRate(b), as assumed by the model
+func (qa *QueueAnalyzer) ServiceTimeCDF() (*ServiceTimeDistribution, error) {
+	model := qa.Model
+	probs := model.GetStateProbabilities()
+	if probs == nil {
+		return nil, fmt.Errorf("model not solved %s", model)
+	}
+	servRate := model.GetServiceRates()
+	weights := make([]float32, len(servRate))
+	meanTimes := make([]float32, len(servRate))
+	var total float64
+	for b := 1; b <= len(servRate); b++ {
+		p := float64(probs[b])
+		if b == len(servRate) {
+			p = float64(model.GetProbBatchFull())
+		}
+		w := p * float64(servRate[b-1])
+		weights[b-1] = float32(w)
+		meanTimes[b-1] = float32(b) / servRate[b-1]
+		total += w
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("no departures at rate %v", model.GetLambdaPerSecond()*float32(qa.Replicas))
+	}
+	for i := range weights {
+		weights[i] = float32(float64(weights[i]) / total)
+	}
+	return &ServiceTimeDistribution{Weights: weights, MeanTimes: meanTimes}, nil
+}
+
+// mean of service time (msec)
+func (d *ServiceTimeDistribution) Mean() float32 {
+	var mean float64
+	for i, w := range d.Weights {
+		mean += float64(w) * float64(d.MeanTimes[i])
+	}
+	return float32(mean)
+}
+
+// probability that service time is at most t (msec)
+func (d *ServiceTimeDistribution) CDF(t float32) float32 {
+	return float32(d.cdf(float64(t)))
+}
+
+func (d *ServiceTimeDistribution) cdf(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	var cdf float64
+	for i, w := range d.Weights {
+		if w > 0 {
+			cdf += float64(w) * (1 - math.Exp(-t/float64(d.MeanTimes[i])))
+		}
+	}
+	return cdf
+}
+
+// quantile of service time (msec), p in (0, 1), by bisection on the CDF
+//   - bracketed by the quantile of the exponential distribution with the largest mean
+func (d *ServiceTimeDistribution) Quantile(p float32) float32 {
+	if p <= 0 || p >= 1 {
+		return 0
+	}
+	var maxMean float64
+	for i, w := range d.Weights {
+		if w > 0 {
+			maxMean = max(maxMean, float64(d.MeanTimes[i]))
+		}
+	}
+	target := float64(p)
+	low, high := 0.0, -maxMean*math.Log(1-target)
+	for range maxQuantileIterations {
+		mid := (low + high) / 2
+		if d.cdf(mid) < target {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return float32((low + high) / 2)
+}
+
+// sample a service time (msec), choosing a batch size by its weight, e.g. to seed a simulation
+func (d *ServiceTimeDistribution) Sample(rng *rand.Rand) float32 {
+	u := rng.Float32()
+	var sum float32
+	last := 0
+	for i, w := range d.Weights {
+		if w <= 0 {
+			continue
+		}
+		last = i
+		sum += w
+		if u < sum {
+			break
+		}
+	}
+	return float32(rng.ExpFloat64()) * d.MeanTimes[last]
+}
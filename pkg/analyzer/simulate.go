@@ -0,0 +1,194 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// fraction of the number of simulated requests arriving before measurements start
+const warmupFraction = 0.1
+
+// simulated request
+type simRequest struct {
+	arrival   float64 // arrival time
+	start     float64 // time service started
+	startArea float64 // integral of batch size over time at service start
+	measured  bool    // arrived after warm-up
+}
+
+// simulate the queue of a replica at a given (total) request rate, a regression oracle for Analyze, returns
+// performance metrics measured over a number of requests arriving after a warm-up period
+//   - requests arrive as a Poisson process and are served in batches with the state-dependent service rates of the model,
+//     an arrival finding the system full is rejected
+//   - an arrival enters service if the batch is not full, otherwise waits in FCFS order,
+//     the next departure from the batch is equally likely any request in service (exponential service times)
+//   - prefill and token times of a request are evaluated at its time-average batch size while in service
+//   - percentiles of token time are over tokens decoded (at the batch size in service) during measurements
+//   - a limit on prefill concurrency and arrival variability (other than Poisson) are not simulated
+//   - same seed gives same results
+func (qa *QueueAnalyzer) Simulate(requestRate float32, numRequests int, seed int64) (metrics *AnalysisMetrics, err error) {
+	if requestRate <= 0 || requestRate > qa.RateRange.Max {
+		return nil, fmt.Errorf("invalid request rate %v, allowed range=%s", requestRate, qa.RateRange)
+	}
+	if numRequests <= 0 {
+		return nil, fmt.Errorf("invalid number of requests %d", numRequests)
+	}
+	servRate, _ := serviceRates(qa.configuration(), qa.serviceMoments())
+	maxBatchSize := qa.MaxBatchSize
+	occupancyUpperBound := math.MaxInt
+	if !qa.Unbounded {
+		occupancyUpperBound = qa.MaxBatchSize + qa.MaxQueueSize
+	}
+	lambda := float64(requestRate) / 1000 / float64(qa.Replicas)
+	rng := rand.New(rand.NewSource(seed))
+
+	warmup := int(float64(numRequests) * warmupFraction)
+	totalArrivals := warmup + numRequests
+	var inService []*simRequest
+	var queue []*simRequest
+
+	// state and measurements
+	var now, area float64 // time, and integral of batch size over time
+	var windowStart, windowEnd float64
+	var areaServ, areaQueue float64
+	var areaRate, areaRateSquared float64 // integrals of departure rate and its square over time
+	var arrivals, measuredArrivals, dropped int
+	var respTimes []float64
+	var sumWait, sumPrefill, sumTokenTime, sumConc float64
+	tokenWeights := make([]float64, maxBatchSize+1) // tokens decoded at each batch size
+
+	for arrivals < totalArrivals || len(inService) > 0 {
+		n := len(inService)
+		arrivalRate := 0.0
+		if arrivals < totalArrivals {
+			arrivalRate = lambda
+		}
+		departureRate := 0.0
+		if n > 0 {
+			departureRate = float64(servRate[n-1])
+		}
+
+		// advance time to next event
+		dt := rng.ExpFloat64() / (arrivalRate + departureRate)
+		if arrivals > warmup && arrivals <= totalArrivals && arrivalRate > 0 {
+			areaServ += float64(n) * dt
+			areaQueue += float64(len(queue)) * dt
+			areaRate += departureRate * dt
+			areaRateSquared += departureRate * departureRate * dt
+			if n > 0 {
+				tokenWeights[n] += float64(n) * dt / float64(qa.tokenTime(float32(n)))
+			}
+		}
+		now += dt
+		area += float64(n) * dt
+
+		if rng.Float64()*(arrivalRate+departureRate) < arrivalRate {
+			// arrival
+			arrivals++
+			r := &simRequest{arrival: now, measured: arrivals > warmup}
+			if r.measured {
+				measuredArrivals++
+				if measuredArrivals == 1 {
+					windowStart = now
+				}
+				windowEnd = now
+			}
+			switch {
+			case n+len(queue) >= occupancyUpperBound:
+				if r.measured {
+					dropped++
+				}
+			case n < maxBatchSize:
+				r.start, r.startArea = now, area
+				inService = append(inService, r)
+			default:
+				queue = append(queue, r)
+			}
+			continue
+		}
+
+		// departure of a request in service chosen at random
+		i := rng.Intn(n)
+		r := inService[i]
+		inService[i] = inService[n-1]
+		inService = inService[:n-1]
+		if len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			next.start, next.startArea = now, area
+			inService = append(inService, next)
+		}
+		if !r.measured {
+			continue
+		}
+		conc := float32(1)
+		if now > r.start {
+			conc = float32((area - r.startArea) / (now - r.start))
+		}
+		prefillTime := qa.timing().PrefillTime(qa.RequestSize.AvgInputTokens, conc)
+		respTimes = append(respTimes, now-r.arrival)
+		sumWait += r.start - r.arrival
+		sumPrefill += float64(prefillTime)
+		sumTokenTime += float64(qa.tokenTime(conc))
+		sumConc += float64(conc)
+	}
+
+	completed := len(respTimes)
+	if completed == 0 {
+		return nil, fmt.Errorf("no requests completed out of %d", numRequests)
+	}
+	sort.Float64s(respTimes)
+	var sumResp float64
+	for _, t := range respTimes {
+		sumResp += t
+	}
+	pBlock := float32(dropped) / float32(measuredArrivals)
+	throughput := requestRate * (1 - pBlock)
+	avgWaitTime := float32(sumWait / float64(completed))
+	avgPrefillTime := float32(sumPrefill / float64(completed))
+	var avgNumInServ, avgQueueLength, throughputStdDev float32
+	if window := windowEnd - windowStart; window > 0 {
+		avgNumInServ = float32(areaServ / window)
+		avgQueueLength = float32(areaQueue / window)
+		avgRate := areaRate / window
+		variance := max(areaRateSquared/window-avgRate*avgRate, 0) * float64(qa.Replicas)
+		throughputStdDev = float32(math.Sqrt(variance)) * 1000
+	}
+	metrics = &AnalysisMetrics{
+		OfferedRate:      requestRate,
+		Throughput:       throughput,
+		ThroughputStdDev: throughputStdDev,
+		Goodput:          throughput,
+		DropRate:         requestRate - throughput,
+		PBlock:           pBlock,
+		AvgRespTime:      float32(sumResp / float64(completed)),
+		AvgWaitTime:      avgWaitTime,
+		P95RespTime:      float32(percentile(respTimes, 0.95)),
+		P99RespTime:      float32(percentile(respTimes, 0.99)),
+		AvgNumInServ:     avgNumInServ,
+		AvgQueueLength:   avgQueueLength,
+		EffConc:          float32(sumConc / float64(completed)),
+		AvgPrefillTime:   avgPrefillTime,
+		AvgTTFT:          timeToFirstToken(avgWaitTime, avgPrefillTime),
+		AvgTokenTime:     float32(sumTokenTime / float64(completed)),
+		P95TokenTime:     qa.tokenTimePercentile(tokenWeights, 0.95),
+		P99TokenTime:     qa.tokenTimePercentile(tokenWeights, 0.99),
+		MaxRate:          qa.RateRange.Max,
+		Rho:              min(max(avgNumInServ/float32(maxBatchSize), 0), 1),
+	}
+	metrics.Regime = qa.Options.regime(metrics.Rho, requestRate/qa.RateRange.Max)
+	if qa.CostPerSecond > 0 && throughput > 0 {
+		metrics.CostPerRequest = qa.CostPerSecond * float32(qa.Replicas) / throughput
+		tokens := qa.RequestSize.AvgInputTokens + qa.RequestSize.AvgOutputTokens
+		metrics.CostPerMillionTokens = metrics.CostPerRequest / tokens * 1e6
+	}
+	return metrics, nil
+}
+
+// percentile of sorted values, p in (0, 1)
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
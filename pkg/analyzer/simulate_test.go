@@ -0,0 +1,75 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// analytic metrics agree with simulated ones, within tolerances of the simulation error, across configurations and
+// loads (simulation as a regression oracle for Analyze)
+func TestSimulateOracle(t *testing.T) {
+	const numRequests = 100000
+	unbounded := testConfig(64, 0)
+	unbounded.Unbounded = true
+	tests := []struct {
+		name   string
+		config *Configuration
+	}{
+		{"large batch", testConfig(64, 100)},
+		{"small queue", testConfig(16, 4)},
+		{"no queue", testConfig(8, 0)},
+		{"unbounded", unbounded},
+	}
+	for _, tt := range tests {
+		qa := newTestAnalyzer(t, tt.config, NewRequestSize(128, 512))
+		for _, fraction := range []float32{0.3, 0.7, 0.9} {
+			t.Run(fmt.Sprintf("%s at %v of max rate", tt.name, fraction), func(t *testing.T) {
+				requestRate := fraction * qa.RateRange.Max
+				analyzed, err := qa.Analyze(requestRate)
+				if err != nil {
+					t.Fatalf("failed to analyze: %v", err)
+				}
+				simulated, err := qa.Simulate(requestRate, numRequests, 1)
+				if err != nil {
+					t.Fatalf("failed to simulate: %v", err)
+				}
+				// waiting time, small near saturation relative to response time, is compared relative to response time
+				for _, m := range []struct {
+					name                string
+					analyzed, simulated float32
+					tolerance, scale    float64
+				}{
+					{"throughput", analyzed.Throughput, simulated.Throughput, 0.01, 0},
+					{"blocking probability", analyzed.PBlock, simulated.PBlock, 0, 0.005},
+					{"response time", analyzed.AvgRespTime, simulated.AvgRespTime, 0.02, 0},
+					{"waiting time", analyzed.AvgWaitTime, simulated.AvgWaitTime, 0, 0.02 * float64(analyzed.AvgRespTime)},
+					{"number in servers", analyzed.AvgNumInServ, simulated.AvgNumInServ, 0.02, 0},
+					{"TTFT", analyzed.AvgTTFT, simulated.AvgTTFT, 0.1, 0},
+					{"ITL", analyzed.AvgTokenTime, simulated.AvgTokenTime, 0.01, 0},
+				} {
+					if diff := math.Abs(float64(m.analyzed - m.simulated)); diff > m.tolerance*float64(m.simulated)+m.scale {
+						t.Errorf("analyzed %s %v, simulated %v", m.name, m.analyzed, m.simulated)
+					}
+				}
+			})
+		}
+	}
+}
+
+// simulation with the same seed gives the same metrics
+func TestSimulateDeterministic(t *testing.T) {
+	qa := newTestAnalyzer(t, testConfig(16, 4), NewRequestSize(128, 512))
+	requestRate := qa.RateRange.Max / 2
+	first, err := qa.Simulate(requestRate, 10000, 7)
+	if err != nil {
+		t.Fatalf("failed to simulate: %v", err)
+	}
+	second, err := qa.Simulate(requestRate, 10000, 7)
+	if err != nil {
+		t.Fatalf("failed to simulate: %v", err)
+	}
+	if *first != *second {
+		t.Errorf("simulation with same seed gave %s, then %s", first, second)
+	}
+}
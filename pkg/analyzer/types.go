@@ -1,70 +1,219 @@
 package analyzer
 
-import "github.com/llm-inferno/queue-analysis/pkg/queue"
+import "github.com/atantawi/llm-queue-model/pkg/queue"
 
-// small disturbance around a value
+// default small disturbance around a value
 const Epsilon = float32(0.001)
 
-// fraction of maximum server throughput to provide stability (running this fraction below the maximum)
+// default fraction of maximum server throughput to provide stability (running this fraction below the maximum)
 const StabilitySafetyFraction = float32(0.1)
 
+// largest batch size considered when sizing the batch
+const BatchSizeCeiling = 1024
+
+// default largest max batch size accepted in a configuration, guarding against huge models (e.g. user-supplied configurations)
+const MaxBatchSizeLimit = 8192
+
+// default largest max queue size accepted in a configuration, guarding against huge models approximating an unbounded
+// queue (the occupancy bound, max batch plus queue sizes, sizes the state probabilities and every pass of a solution)
+//   - a queue this long is effectively unbounded at any stable load, modeled in closed form by an unbounded queue
+const MaxQueueSizeLimit = 65536
+
+// number of evenly-spaced request rates sampled when locating the knee of the latency curve
+const KneeSamples = 100
+
+// default thresholds of load, the larger of utilization and offered rate relative to the max rate, between regimes
+const (
+	UnderloadedLoad    = float32(0.2)  // below: underloaded
+	NearSaturationLoad = float32(0.8)  // at or above: near saturation
+	SaturatedLoad      = float32(0.95) // at or above: saturated
+)
+
+// operating regime of a server, a categorical health signal (e.g. traffic light on dashboards)
+type Regime string
+
+const (
+	RegimeUnderloaded    Regime = "Underloaded"    // capacity mostly idle, may be scaled in
+	RegimeHealthy        Regime = "Healthy"        // load within comfortable range
+	RegimeNearSaturation Regime = "NearSaturation" // latency climbing, little headroom
+	RegimeSaturated      Regime = "Saturated"      // at capacity, requests queue or are rejected
+)
+
 // Analyzer of inference server queue
 type QueueAnalyzer struct {
-	MaxBatchSize int                           // maximum batch size
-	MaxQueueSize int                           // maximum queue size
-	ServiceParms *ServiceParms                 // request processing parameters
-	RequestSize  *RequestSize                  // number of input and output tokens per request
-	Model        *queue.MM1ModelStateDependent // queueing model
-	RateRange    *RateRange                    // range of request rates for model stability
+	MaxBatchSize          int                           // maximum batch size (limited by KV cache memory, if given)
+	ConfigMaxBatchSize    int                           // maximum batch size of the configuration, before limit by KV cache memory
+	FractionalMaxBatch    float32                       // fractional maximum batch size of the configuration (zero if integer)
+	KVCache               *KVCacheParms                 // KV cache memory limiting the batch size (nil if not limited)
+	MaxQueueSize          int                           // maximum queue size
+	LossOnly              bool                          // requests rejected when all batch slots are busy (no queueing)
+	MaxPrefillConcurrency int                           // limit on requests of the batch concurrently in prefill (zero if not limited)
+	MaxPrefillBatch       int                           // ceiling on the batch size of the prefill stage (zero if not limited)
+	MaxDecodeBatch        int                           // ceiling on the batch size of the decode stage (zero if not limited)
+	Unbounded             bool                          // unbounded queue (max queue size ignored)
+	Replicas              int                           // number of identical replicas sharing the load evenly
+	CostPerSecond         float32                       // cost of running a replica per second (zero if not considered)
+	ServiceParms          *ServiceParms                 // request processing parameters
+	RequestSize           *RequestSize                  // number of input and output tokens per request
+	Options               *AnalyzerOptions              // analyzer tuning parameters
+	ServiceSCV            float32                       // squared coefficient of variation of request service time
+	ArrivalSCV            float32                       // squared coefficient of variation of interarrival time (zero for Poisson arrivals)
+	Model                 *queue.MM1ModelStateDependent // queueing model (of a single replica)
+	RateRange             *RateRange                    // range of request rates for model stability (all replicas)
+
+	classes []*WorkloadClass // request classes of a mix the model was built from (nil for a single class)
 }
 
 // queue configuration parameters
 type Configuration struct {
-	MaxBatchSize int           // maximum batch size (limit on the number of requests concurrently receiving service >0)
-	MaxQueueSize int           // maximum queue size (limit on the number of requests queued for servive >=0)
-	ServiceParms *ServiceParms // request processing parameters
+	MaxBatchSize          int              `json:"maxBatchSize"`                    // maximum batch size (limit on the number of requests concurrently receiving service >0)
+	FractionalMaxBatch    float32          `json:"fractionalMaxBatch,omitempty"`    // fractional maximum batch size, e.g. measured average batch ceiling, with max batch size its value rounded up (zero if integer)
+	MaxQueueSize          int              `json:"maxQueueSize"`                    // maximum queue size (limit on the number of requests queued for servive >=0)
+	LossOnly              bool             `json:"lossOnly,omitempty"`              // reject requests when all batch slots are busy rather than queue them (max queue size ignored)
+	MaxPrefillConcurrency int              `json:"maxPrefillConcurrency,omitempty"` // limit on requests of the batch concurrently in prefill, admitted requests wait for a prefill slot (zero if not limited)
+	MaxPrefillBatch       int              `json:"maxPrefillBatch,omitempty"`       // ceiling on the batch size of the prefill stage, below max batch size if limited (zero if not limited)
+	MaxDecodeBatch        int              `json:"maxDecodeBatch,omitempty"`        // ceiling on the batch size of the decode stage, below max batch size if limited (zero if not limited)
+	Unbounded             bool             `json:"unbounded,omitempty"`             // never reject requests, queue without limit (max queue size ignored, not with lossOnly)
+	Replicas              int              `json:"replicas,omitempty"`              // number of identical replicas behind a load balancer (>=0, zero means one replica)
+	CostPerSecond         float32          `json:"costPerSec,omitempty"`            // cost of running a replica per second (>=0, zero if not considered)
+	ArrivalSCV            float32          `json:"arrivalSCV,omitempty"`            // squared coefficient of variation of interarrival time, burstiness of traffic (>=0, zero for Poisson arrivals, same as one)
+	ServiceParms          *ServiceParms    `json:"serviceParms"`                    // request processing parameters
+	KVCache               *KVCacheParms    `json:"kvCache,omitempty"`               // optional KV cache memory limiting the batch size (nil if not limited)
+	Options               *AnalyzerOptions `json:"options,omitempty"`               // optional analyzer tuning parameters (defaults if nil)
+}
+
+// KV cache memory: the batch size is limited by the number of requests whose KV cache fits in memory
+//   - a request holds the KV cache of its full sequence (average input and output tokens)
+type KVCacheParms struct {
+	MemoryBudget  float32 `json:"memoryBudget"`  // memory available for the KV cache (bytes)
+	BytesPerToken float32 `json:"bytesPerToken"` // KV cache footprint of a token (bytes)
+}
+
+// optional setting of a configuration, applied when creating an analyzer
+type Option func(*Configuration)
+
+// analyzer tuning parameters
+type AnalyzerOptions struct {
+	Epsilon                 float32 `json:"epsilon"`                     // small disturbance setting the range of request rates (0 < epsilon < 1)
+	StabilitySafetyFraction float32 `json:"stabilitySafetyFraction"`     // fraction of maximum throughput kept as a margin for target TPS (0 <= fraction < 1)
+	MaxBatchSizeLimit       int     `json:"maxBatchSizeLimit,omitempty"` // largest max batch size accepted (zero for default of MaxBatchSizeLimit)
+	MaxQueueSizeLimit       int     `json:"maxQueueSizeLimit,omitempty"` // largest max queue size accepted (zero for default of MaxQueueSizeLimit)
+	LinearSolver            bool    `json:"linearSolver,omitempty"`      // solve the model as a linear system of balance equations rather than by recurrence (default)
+	LowerMargin             float32 `json:"lowerMargin,omitempty"`       // min rate as a fraction of the service rate at batch size 1 (0 <= margin < 1, zero for epsilon)
+	UpperMargin             float32 `json:"upperMargin,omitempty"`       // fraction of the max service rate cut from the max rate (0 <= margin < 1, zero for epsilon)
+
+	// thresholds of load between regimes, increasing in [0, 1] (zero for defaults of UnderloadedLoad,
+	// NearSaturationLoad, SaturatedLoad)
+	UnderloadedLoad    float32 `json:"underloadedLoad,omitempty"`
+	NearSaturationLoad float32 `json:"nearSaturationLoad,omitempty"`
+	SaturatedLoad      float32 `json:"saturatedLoad,omitempty"`
 }
 
 // request processing parameters
+//   - alternative timing models (e.g. tabulated) may be plugged in place of the prefill or decode parameters
 type ServiceParms struct {
-	Prefill *PrefillParms // parameters to calculate prefill time
-	Decode  *DecodeParms  // parameters to calculate decode time
+	Prefill      *PrefillParms     `json:"prefill"`               // parameters to calculate prefill time
+	Decode       *DecodeParms      `json:"decode"`                // parameters to calculate decode time
+	Speculative  *SpeculativeParms `json:"speculative,omitempty"` // speculative decoding parameters (nil if not speculative)
+	PrefillModel PrefillModel      `json:"-"`                     // prefill time model used in place of the prefill parameters (nil if none)
+	DecodeModel  DecodeModel       `json:"-"`                     // decode time model used in place of the decode parameters (nil if none)
 }
 
+// model of the prefill time of a request, implemented by PrefillParms
+//   - prefill time (msec) given the number of input tokens and the batch size, zero if there are no input tokens
+//   - chunking of prefill is up to the model (chunk size of prefill parameters not applied)
+type PrefillModel interface {
+	PrefillTime(avgInputTokens float32, batchSize float32) float32
+}
+
+// model of the decode time of a forward pass of the batch, implemented by DecodeParms
+//   - decode time (msec) given the batch size, increasing with batch size
+//   - divided by the expected number of tokens per forward pass if speculative
+type DecodeModel interface {
+	DecodeTime(batchSize float32) float32
+}
+
+var (
+	_ PrefillModel = (*PrefillParms)(nil)
+	_ DecodeModel  = (*DecodeParms)(nil)
+)
+
 // prefill time = gamma + delta * inputTokens * batchSize (msec); inputTokens > 0
+// chunked prefill time = gamma + delta * inputTokens + numChunks * decodeTime(batchSize) (msec)
+// with prompt caching, inputTokens are the uncached input tokens, inputTokens * (1 - cacheHitRate)
 type PrefillParms struct {
-	Gamma float32 // base
-	Delta float32 // slope
+	Gamma        float32 `json:"gamma"`                  // base
+	Delta        float32 `json:"delta"`                  // slope
+	ChunkSize    int     `json:"chunkSize,omitempty"`    // max number of input tokens in a prefill chunk (zero if prefill not chunked)
+	CacheHitRate float32 `json:"cacheHitRate,omitempty"` // fraction of input tokens found in the prompt cache, skipping prefill (zero if no caching)
 }
 
 // decode time = alpha + beta * batchSize (msec); batchSize > 0
+// piecewise-linear decode time (tabulated): alpha at batch size zero, continuous with slope slopes[i] from batch size breakpoints[i]
+// with a position slope, the k-th decode step of a request takes positionSlope * k longer (KV cache growing with position)
 type DecodeParms struct {
-	Alpha float32 // base
-	Beta  float32 // slope
+	Alpha         float32   `json:"alpha"`                   // base
+	Beta          float32   `json:"beta"`                    // slope (ignored if piecewise-linear)
+	Breakpoints   []float32 `json:"breakpoints,omitempty"`   // increasing batch sizes starting segments, first is zero (empty if linear)
+	Slopes        []float32 `json:"slopes,omitempty"`        // slope of each segment
+	PositionSlope float32   `json:"positionSlope,omitempty"` // growth of decode time per output token of position (zero if none)
+}
+
+// speculative decoding: a draft of tokens is verified by a single forward pass, each draft token accepted with some probability
+// decode time per token = (alpha + beta * batchSize) / expected number of tokens per forward pass
+type SpeculativeParms struct {
+	AcceptanceRate float32 `json:"acceptanceRate"` // probability that a draft token is accepted (0 <= rate <= 1)
+	DraftLength    int     `json:"draftLength"`    // number of draft tokens proposed per forward pass
 }
 
 // request tokens data
 type RequestSize struct {
-	AvgInputTokens  int // average number of input tokens per request
-	AvgOutputTokens int // average number of output tokens per request
+	AvgInputTokens  float32       `json:"avgInputTokens"`         // average number of input tokens per request (may be fractional)
+	AvgOutputTokens float32       `json:"avgOutputTokens"`        // average number of output tokens per request (may be fractional)
+	Distribution    []*SizeBucket `json:"distribution,omitempty"` // optional distribution of request sizes, consistent with averages (empty if only averages known)
+}
+
+// bucket of requests of the same size in a request size distribution
+type SizeBucket struct {
+	InputTokens  int     `json:"inputTokens"`  // number of input tokens per request
+	OutputTokens int     `json:"outputTokens"` // number of output tokens per request
+	Weight       float32 `json:"weight"`       // relative frequency of requests in bucket
 }
 
 // range of request rates (requests/sec)
+//   - rates in (0, Min) are idle: analysis reports the idle baseline (Baseline) at the rate, flagged as Idle, rather than
+//     solving a degenerate chain of (almost) no arrivals, and leaves the model solved at Min
 type RateRange struct {
-	Min float32 // lowest rate (slightly larger than zero)
+	Min float32 // lowest rate solved (slightly larger than zero), threshold of idle rates below
 	Max float32 // highest rate (slightly less than maximum service rate)
 }
 
 // analysis solution metrics data
 type AnalysisMetrics struct {
-	Throughput     float32 // effective throughput (requests/sec)
-	AvgRespTime    float32 // average request response time (aka latency) (msec)
-	AvgWaitTime    float32 // average request queueing time (msec)
-	AvgNumInServ   float32 // average number of requests in service
-	AvgPrefillTime float32 // average request prefill time (msec)
-	AvgTokenTime   float32 // average token decode time (msec)
-	MaxRate        float32 // maximum throughput (requests/sec)
-	Rho            float32 // utilization
+	OfferedRate          float32 // offered request rate (requests/sec)
+	Throughput           float32 // effective (admitted) throughput (requests/sec)
+	ThroughputStdDev     float32 // standard deviation of throughput, as the departure rate fluctuates with the number in system (requests/sec)
+	Goodput              float32 // throughput of requests meeting performance targets, all if no targets (requests/sec)
+	DropRate             float32 // rate of requests rejected due to a full system (requests/sec)
+	PBlock               float32 // probability that an arriving request is rejected
+	AvgRespTime          float32 // average request response time (aka latency) (msec)
+	AvgWaitTime          float32 // average request queueing time (msec)
+	P95RespTime          float32 // 95th percentile of request response time (msec)
+	P99RespTime          float32 // 99th percentile of request response time (msec)
+	AvgNumInServ         float32 // average number of requests in service (per replica)
+	AvgQueueLength       float32 // average number of requests waiting in queue (per replica)
+	EffConc              float32 // effective concurrency, batch size consistent with average service time (per replica)
+	AvgPrefillTime       float32 // average request prefill time (msec)
+	AvgTTFT              float32 // average time to first token, AvgWaitTime + AvgPrefillTime (msec)
+	AvgTokenTime         float32 // average token decode time (msec)
+	P95TokenTime         float32 // 95th percentile of token decode time over tokens, as batch size varies (msec)
+	P99TokenTime         float32 // 99th percentile of token decode time over tokens, as batch size varies (msec)
+	MaxRate              float32 // maximum throughput (requests/sec)
+	Rho                  float32 // utilization (per replica)
+	Regime               Regime  // operating regime, from the larger of utilization and offered rate relative to max rate
+	Idle                 bool    // request rate below the min rate of the range, metrics of the idle baseline rather than of a solved model
+	CostPerRequest       float32 // cost of all replicas per second amortized over throughput (zero if cost not considered)
+	CostPerMillionTokens float32 // cost per million (input and output) tokens processed (zero if cost not considered)
 }
 
 // queue performance targets
@@ -74,9 +223,136 @@ type TargetPerf struct {
 	TargetTPS  float32 // target token generation throughtput (tokens/sec)
 }
 
+// queue performance targets with explicit presence, nil if not considered, so that a set value is enforced even if
+// zero (e.g. computed), rather than zero meaning not considered as in TargetPerf
+type OptionalTargetPerf struct {
+	TargetTTFT *float32 // target time to first token (queueing + prefill) (msec)
+	TargetITL  *float32 // target inter-token latency (msec)
+	TargetTPS  *float32 // target token generation throughtput (tokens/sec)
+}
+
 // queue max request rates to achieve performance targets
 type TargetRate struct {
 	RateTargetTTFT float32 // max request rate for target TTFT (requests/sec)
 	RateTargetITL  float32 // max request rate for target ITL (requests/sec)
-	RateTargetTPS  float32 // max request rate for target TPS (requests/sec)
+	RateTargetTPS  float32 // request rate achieving target TPS, capped by the max rate less the stability safety fraction (requests/sec)
+	Converged      bool    // searches for rates converged (if not, rates are at the low end of the last search bracket)
+	TTFTMetAtMax   bool    // target TTFT met at all rates, up to the max rate (target may be tightened)
+	ITLMetAtMax    bool    // target ITL met at all rates, up to the max rate (target may be tightened)
+	Rate           float32 // chosen request rate, smallest of the rates above (requests/sec)
+	Binding        string  // target limiting the chosen rate (TTFT, ITL, TPS), empty if limited by the max rate
+
+	// performance metrics at each of the max request rates above, the tradeoff between targets
+	// (nil unless requested by the sizing option AllRates)
+	MetricsTTFT *AnalysisMetrics
+	MetricsITL  *AnalysisMetrics
+	MetricsTPS  *AnalysisMetrics
+}
+
+// score of performance metrics, a blended objective kept within a budget when sizing (should increase with request rate)
+type ScoreFunc func(metrics *AnalysisMetrics) float32
+
+// error returned by sizing when a target cannot be achieved at any rate (target should be loosened)
+type TargetInfeasibleError struct {
+	Metric   string  // name of target metric (TTFT, ITL, TPS, RespTime, Score, PBlock)
+	Target   float32 // target value
+	MinValue float32 // best achievable value of metric, at the lowest rate
+	MaxValue float32 // value of metric at the max rate
+}
+
+// error returned by analysis when the request rate exceeds the max rate of the configuration (overload),
+// e.g. to decide how aggressively to shed load
+type RateExceedsMaxError struct {
+	Rate     float32 // request rate (requests/sec)
+	MaxRate  float32 // max request rate of the configuration (requests/sec)
+	Overload float32 // overload ratio, request rate over max rate (above one)
+}
+
+// measured prefill time sample
+type PrefillSample struct {
+	InputTokens int     // number of input tokens
+	BatchSize   float32 // batch size
+	PrefillTime float32 // measured prefill time (msec)
+}
+
+// measured decode time sample
+type DecodeSample struct {
+	BatchSize  float32 // batch size
+	DecodeTime float32 // measured decode time (msec)
+}
+
+// options for sizing
+type SizeOptions struct {
+	Hint          *TargetRate // max request rates of a previous sizing to warm start the search (nil if none)
+	Tolerance     float32     // relative tolerance of target metric in search (zero for default of 1e-6)
+	MaxIterations int         // maximum number of search iterations per target (zero for default of 100)
+	AllRates      bool        // analyze at the max request rate of each target, not only the chosen rate (reported in the sizing result)
+	// called with each request rate (requests/sec) evaluated when searching for the max rate of a target (TTFT, ITL)
+	// and the value of the target metric (nil if not traced)
+	Trace func(target string, requestRate float32, value float32)
+}
+
+// Analyzer of inference server queue serving a mix of request classes
+type MultiClassAnalyzer struct {
+	*QueueAnalyzer                  // analyzer of the combined workload (request size averaged over classes)
+	Classes        []*WorkloadClass // request classes, with arrival fractions normalized to sum to one
+}
+
+// class of requests in a multi-class workload
+type WorkloadClass struct {
+	Name            string       `json:"name,omitempty"`  // class name (optional)
+	RequestSize     *RequestSize `json:"requestSize"`     // number of input and output tokens per request of class
+	ArrivalFraction float32      `json:"arrivalFraction"` // fraction of arriving requests belonging to class
+}
+
+// performance metrics of a multi-class workload
+type MultiClassMetrics struct {
+	Aggregate *AnalysisMetrics // metrics of the combined workload
+	Classes   []*ClassMetrics  // metrics of each class, in the order of the classes
+}
+
+// performance metrics of a request class
+type ClassMetrics struct {
+	Name           string  // class name
+	Throughput     float32 // effective (admitted) throughput of class (requests/sec)
+	AvgRespTime    float32 // average request response time (msec)
+	AvgPrefillTime float32 // average request prefill time (msec)
+	TTFT           float32 // average time to first token (queueing + prefill) (msec)
+	ITL            float32 // average inter-token latency (msec)
+}
+
+// prefill/decode disaggregated deployment: prefill and decode on separate pools of servers, in tandem
+type DisaggregatedConfiguration struct {
+	Prefill *Configuration `json:"prefill"` // configuration of prefill stage (decode parameters optional and unused, no chunking)
+	Decode  *Configuration `json:"decode"`  // configuration of decode stage (prefill parameters optional and unused)
+}
+
+// Analyzer of a prefill/decode disaggregated deployment, two queues in tandem
+//   - prefill stage processes input tokens and generates the first output token
+//   - decode stage generates the remaining output tokens, arrivals are departures of prefill stage
+type DisaggregatedAnalyzer struct {
+	PrefillStage *QueueAnalyzer // analyzer of prefill stage
+	DecodeStage  *QueueAnalyzer // analyzer of decode stage
+	RequestSize  *RequestSize   // number of input and output tokens per request
+	RateRange    *RateRange     // range of request rates for stability of both stages
+}
+
+// performance metrics of a prefill/decode disaggregated deployment
+type DisaggregatedMetrics struct {
+	OfferedRate  float32          // offered request rate (requests/sec)
+	Throughput   float32          // effective throughput of requests completing both stages (requests/sec)
+	AvgRespTime  float32          // average end-to-end request response time (msec)
+	AvgTTFT      float32          // average time to first token, queueing and service at prefill stage (msec)
+	AvgTokenTime float32          // average token decode time at decode stage (msec)
+	MaxRate      float32          // maximum throughput (requests/sec)
+	Prefill      *AnalysisMetrics // metrics of prefill stage
+	Decode       *AnalysisMetrics // metrics of decode stage
+}
+
+// distribution of request service time at an operating point, a mixture over batch sizes of exponential distributions
+//   - a request completes at batch size b (index b-1) with probability Weights[b-1], in proportion to the rate of
+//     departures at batch size b, with mean service time MeanTimes[b-1]
+type ServiceTimeDistribution struct {
+	Weights   []float32 // probabilities of batch sizes at completion (summing to one)
+	MeanTimes []float32 // average request service time at each batch size (msec)
 }
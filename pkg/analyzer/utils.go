@@ -1,21 +1,425 @@
 package analyzer
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	utils "github.com/atantawi/llm-queue-model/pkg/utils"
+)
+
+// relative tolerance when comparing service rates
+const serviceRateTolerance = 1e-6
+
+// relative tolerance when comparing a request rate with the min rate of the range, so that the min rate converted to
+// requests/msec and back (rounding to float32) is not taken as idle
+const minRateTolerance = 1e-6
+
+// number of bisection iterations when solving for the effective concurrency of alternative timing models
+const maxConcurrencyIterations = 50
+
+// target cannot be achieved at any rate, matched by errors.Is on a TargetInfeasibleError
+var ErrTargetInfeasible = errors.New("target infeasible")
+
+// request rate exceeds the max rate of the configuration, matched by errors.Is on a RateExceedsMaxError
+var ErrRateExceedsMax = errors.New("rate exceeds max")
+
+// error for a request rate above the max rate
+func rateExceedsMax(requestRate float32, maxRate float32) error {
+	return &RateExceedsMaxError{Rate: requestRate, MaxRate: maxRate, Overload: requestRate / maxRate}
+}
 
 // check validity of configuration parameters
 func (c *Configuration) check() error {
-	if c.MaxBatchSize <= 0 || c.MaxQueueSize < 0 || c.ServiceParms == nil ||
-		c.ServiceParms.Prefill == nil || c.ServiceParms.Decode == nil {
+	if c.MaxBatchSize <= 0 || c.MaxQueueSize < 0 || c.Replicas < 0 || c.CostPerSecond < 0 || c.MaxPrefillConcurrency < 0 ||
+		c.MaxPrefillBatch < 0 || c.MaxDecodeBatch < 0 || c.ArrivalSCV < 0 || c.ServiceParms == nil ||
+		c.ServiceParms.Prefill == nil && c.ServiceParms.PrefillModel == nil ||
+		c.ServiceParms.Decode == nil && c.ServiceParms.DecodeModel == nil ||
+		c.LossOnly && c.Unbounded {
 		return fmt.Errorf("invalid configuration %s", c)
 	}
+	if err := c.ServiceParms.check(); err != nil {
+		return err
+	}
+	if k := c.KVCache; k != nil && (k.MemoryBudget <= 0 || k.BytesPerToken <= 0) {
+		return fmt.Errorf("invalid KV cache parameters %s", k)
+	}
+	if c.Options != nil {
+		if err := c.Options.check(); err != nil {
+			return err
+		}
+	}
+	if f := c.FractionalMaxBatch; f != 0 && (f < 1 || f <= float32(c.MaxBatchSize-1) || f > float32(c.MaxBatchSize)) {
+		return fmt.Errorf("fractional max batch size %v does not round up to max batch size %d", f, c.MaxBatchSize)
+	}
+	if limit := c.Options.batchSizeLimit(); c.MaxBatchSize > limit {
+		return fmt.Errorf("max batch size %d exceeds limit %d (analyzer option maxBatchSizeLimit)", c.MaxBatchSize, limit)
+	}
+	if limit := c.Options.queueSizeLimit(); c.MaxQueueSize > limit && !c.Unbounded && !c.LossOnly {
+		return fmt.Errorf("max queue size %d exceeds limit %d (analyzer option maxQueueSizeLimit), use an unbounded queue instead",
+			c.MaxQueueSize, limit)
+	}
+	if c.MaxQueueSize > math.MaxInt-c.MaxBatchSize-1 {
+		// occupancy bound (plus one state for zero) would overflow, e.g. on 32-bit platforms with limits raised
+		return fmt.Errorf("max queue size %d and max batch size %d overflow the occupancy bound", c.MaxQueueSize, c.MaxBatchSize)
+	}
+	return nil
+}
+
+// timing of request processing of a configuration, with the batch sizes of prefill and decode limited by their ceilings
+//   - independent of the max batch size, which may change (e.g. sizing the batch) while the timing is in use
+func (c *Configuration) timing() *ServiceParms {
+	return stageTiming(c.ServiceParms, c.MaxPrefillBatch, c.MaxDecodeBatch, math.MaxInt)
+}
+
+// weight of the service rate at max batch size, interpolating linearly between the service rates at max batch size
+// and one less, to model a fractional max batch size (one if the max batch size is an integer or limited below it)
+func (c *Configuration) maxBatchWeight() float32 {
+	f := c.FractionalMaxBatch
+	n := float32(c.MaxBatchSize)
+	if f <= n-1 || f >= n {
+		return 1
+	}
+	return f - (n - 1)
+}
+
+// configuration with max batch size limited by the KV cache memory given request size, returns
+//   - same configuration if KV cache memory not given or not limiting
+//   - error if a request does not fit in the KV cache memory (configuration limited to a batch of one)
+func (c *Configuration) limitedBy(requestSize *RequestSize) (*Configuration, error) {
+	if c.KVCache == nil {
+		return c, nil
+	}
+	tokens := requestSize.AvgInputTokens + requestSize.AvgOutputTokens
+	n := int(c.KVCache.MemoryBudget / (c.KVCache.BytesPerToken * tokens))
+	if n >= c.MaxBatchSize {
+		return c, nil
+	}
+	config := *c
+	config.MaxBatchSize = max(n, 1)
+	if n < 1 {
+		return &config, fmt.Errorf("KV cache memory %s does not fit a request of %v tokens", c.KVCache, tokens)
+	}
+	return &config, nil
+}
+
+// check that service parameters are physically sensible
+//   - base times (gamma, alpha) are positive, slopes (delta, beta) and chunk size are non-negative
+//   - acceptance rate of speculative decoding is a probability, with at least one draft token
+//   - parameters replaced by timing models are not checked (nor are the models)
+func (sp *ServiceParms) check() error {
+	if p := sp.Prefill; sp.PrefillModel == nil {
+		switch {
+		case p.Gamma <= 0:
+			return fmt.Errorf("invalid prefill parameter gamma=%v, base time should be positive", p.Gamma)
+		case p.Delta < 0:
+			return fmt.Errorf("invalid prefill parameter delta=%v, should be non-negative", p.Delta)
+		case p.ChunkSize < 0:
+			return fmt.Errorf("invalid prefill parameter chunkSize=%d, should be non-negative", p.ChunkSize)
+		case p.CacheHitRate < 0 || p.CacheHitRate > 1:
+			return fmt.Errorf("invalid prefill parameter cacheHitRate=%v, should be in [0, 1]", p.CacheHitRate)
+		}
+	}
+	if s := sp.Speculative; s != nil && (s.AcceptanceRate < 0 || s.AcceptanceRate > 1 || s.DraftLength < 1) {
+		return fmt.Errorf("invalid speculative decoding parameters %s", s)
+	}
+	if sp.DecodeModel != nil {
+		return nil
+	}
+	d := sp.Decode
+	switch {
+	case d.Alpha <= 0:
+		return fmt.Errorf("invalid decode parameter alpha=%v, base time should be positive", d.Alpha)
+	case d.Beta < 0:
+		return fmt.Errorf("invalid decode parameter beta=%v, should be non-negative", d.Beta)
+	case d.PositionSlope < 0:
+		return fmt.Errorf("invalid decode parameter positionSlope=%v, should be non-negative", d.PositionSlope)
+	case len(d.Breakpoints) != len(d.Slopes):
+		return fmt.Errorf("invalid decode parameters, %d breakpoints and %d slopes", len(d.Breakpoints), len(d.Slopes))
+	case len(d.Breakpoints) > 0 && d.Breakpoints[0] != 0:
+		return fmt.Errorf("invalid decode parameter breakpoints[0]=%v, should be zero", d.Breakpoints[0])
+	}
+	for i, slope := range d.Slopes {
+		if slope < 0 {
+			return fmt.Errorf("invalid decode parameter slopes[%d]=%v, should be non-negative", i, slope)
+		}
+		if i > 0 && d.Breakpoints[i] <= d.Breakpoints[i-1] {
+			return fmt.Errorf("invalid decode parameter breakpoints[%d]=%v, should be increasing", i, d.Breakpoints[i])
+		}
+	}
+	return nil
+}
+
+// check that service rates are positive and do not decrease with batch size,
+// as the rate at max batch size is taken as the maximum service rate
+func checkServiceRates(servRate []float32) error {
+	for n, rate := range servRate {
+		if rate <= 0 || math.IsInf(float64(rate), 0) || math.IsNaN(float64(rate)) {
+			return fmt.Errorf("invalid service rate %v at batch size %d", rate, n+1)
+		}
+		if n > 0 && rate < servRate[n-1]*(1-serviceRateTolerance) {
+			return fmt.Errorf("service rate decreases from %v at batch size %d to %v at batch size %d, max batch size should not exceed %d",
+				servRate[n-1], n, rate, n+1, n)
+		}
+	}
+	return nil
+}
+
+// check that a range of request rates is not empty (nor invalid), given the service rates (requests/msec) of a replica
+// at batch sizes 1 and max from which it is set
+//   - the range collapses if the max service rate, possibly limited by prefill capacity, is hardly above the small
+//     disturbance (epsilon) of the service rate at batch size 1, leaving no rates to scale over (e.g. in sizing)
+func checkRateRange(rateRange *RateRange, minServRate float32, maxServRate float32) error {
+	if !(rateRange.Min < rateRange.Max) {
+		return fmt.Errorf("empty rate range %s: service rate curve too flat for meaningful rate scaling, "+
+			"service rate %v at batch size 1 and %v at max batch size (requests/msec), before limit by prefill capacity",
+			rateRange, minServRate, maxServRate)
+	}
 	return nil
 }
 
+// check validity of analyzer options
+func (o *AnalyzerOptions) check() error {
+	if o.Epsilon <= 0 || o.Epsilon >= 1 ||
+		o.StabilitySafetyFraction < 0 || o.StabilitySafetyFraction >= 1 || o.MaxBatchSizeLimit < 0 || o.MaxQueueSizeLimit < 0 ||
+		o.LowerMargin < 0 || o.LowerMargin >= 1 || o.UpperMargin < 0 || o.UpperMargin >= 1 {
+		return fmt.Errorf("invalid analyzer options %s", o)
+	}
+	if underloaded, nearSaturation, saturated := o.regimeThresholds(); underloaded < 0 ||
+		underloaded > nearSaturation || nearSaturation > saturated || saturated > 1 {
+		return fmt.Errorf("invalid regime thresholds %v, %v, %v, should be increasing in [0, 1]", underloaded, nearSaturation, saturated)
+	}
+	return nil
+}
+
+// margins of the range of request rates, below the service rate at batch size 1 and the max service rate,
+// epsilon unless set
+func (o *AnalyzerOptions) margins() (lower float32, upper float32) {
+	lower, upper = o.Epsilon, o.Epsilon
+	if o.LowerMargin != 0 {
+		lower = o.LowerMargin
+	}
+	if o.UpperMargin != 0 {
+		upper = o.UpperMargin
+	}
+	return lower, upper
+}
+
+// thresholds of load between regimes given analyzer options (nil for defaults), defaults for unset values
+func (o *AnalyzerOptions) regimeThresholds() (underloaded float32, nearSaturation float32, saturated float32) {
+	underloaded, nearSaturation, saturated = UnderloadedLoad, NearSaturationLoad, SaturatedLoad
+	if o == nil {
+		return
+	}
+	if o.UnderloadedLoad != 0 {
+		underloaded = o.UnderloadedLoad
+	}
+	if o.NearSaturationLoad != 0 {
+		nearSaturation = o.NearSaturationLoad
+	}
+	if o.SaturatedLoad != 0 {
+		saturated = o.SaturatedLoad
+	}
+	return
+}
+
+// operating regime given utilization and offered rate relative to max rate
+func (o *AnalyzerOptions) regime(rho float32, relativeRate float32) Regime {
+	underloaded, nearSaturation, saturated := o.regimeThresholds()
+	load := max(rho, relativeRate)
+	switch {
+	case load >= saturated:
+		return RegimeSaturated
+	case load >= nearSaturation:
+		return RegimeNearSaturation
+	case load < underloaded:
+		return RegimeUnderloaded
+	}
+	return RegimeHealthy
+}
+
+// largest max batch size accepted given analyzer options (nil for defaults)
+func (o *AnalyzerOptions) batchSizeLimit() int {
+	if o == nil || o.MaxBatchSizeLimit == 0 {
+		return MaxBatchSizeLimit
+	}
+	return o.MaxBatchSizeLimit
+}
+
+// largest max queue size accepted given analyzer options (nil for defaults)
+func (o *AnalyzerOptions) queueSizeLimit() int {
+	if o == nil || o.MaxQueueSizeLimit == 0 {
+		return MaxQueueSizeLimit
+	}
+	return o.MaxQueueSizeLimit
+}
+
+// default analyzer options
+func DefaultAnalyzerOptions() *AnalyzerOptions {
+	return &AnalyzerOptions{
+		Epsilon:                 Epsilon,
+		StabilitySafetyFraction: StabilitySafetyFraction,
+	}
+}
+
+// request size given whole average numbers of input and output tokens
+func NewRequestSize(avgInputTokens int, avgOutputTokens int) *RequestSize {
+	return &RequestSize{
+		AvgInputTokens:  float32(avgInputTokens),
+		AvgOutputTokens: float32(avgOutputTokens),
+	}
+}
+
+// request size of a combination of request size profiles (e.g. workloads) given their traffic weights (relative
+// request rates), the traffic-weighted averages of input and output tokens
+//   - averages are not rounded (fractional averages are supported), rounding the weighted sum would bias the mix
+//   - weights are non-negative, with a positive sum (normalized)
+//   - distributions of request sizes are combined, with bucket weights scaled by traffic weight, if all profiles
+//     with a positive weight have one, otherwise only averages are kept
+func CombineRequestSizes(profiles []*RequestSize, weights []float32) (*RequestSize, error) {
+	if len(profiles) == 0 || len(profiles) != len(weights) {
+		return nil, fmt.Errorf("mismatched number of request size profiles %d and weights %d", len(profiles), len(weights))
+	}
+	var sumWeights float64
+	for i, w := range weights {
+		if w < 0 || math.IsNaN(float64(w)) || math.IsInf(float64(w), 0) {
+			return nil, fmt.Errorf("invalid weight %v of request size profile %d", w, i)
+		}
+		if profiles[i] == nil {
+			return nil, fmt.Errorf("missing request size profile %d", i)
+		}
+		if err := profiles[i].check(); err != nil {
+			return nil, fmt.Errorf("profile %d: %v", i, err)
+		}
+		sumWeights += float64(w)
+	}
+	if sumWeights <= 0 {
+		return nil, fmt.Errorf("no traffic, weights %v sum to zero", weights)
+	}
+	var inTokens, outTokens float64
+	var buckets []*SizeBucket
+	withDistribution := true
+	for i, rq := range profiles {
+		if weights[i] == 0 {
+			continue
+		}
+		fraction := float64(weights[i]) / sumWeights
+		inTokens += fraction * float64(rq.AvgInputTokens)
+		outTokens += fraction * float64(rq.AvgOutputTokens)
+		if len(rq.Distribution) == 0 {
+			withDistribution = false
+			continue
+		}
+		var sumBucketWeights float64
+		for _, b := range rq.Distribution {
+			sumBucketWeights += float64(b.Weight)
+		}
+		for _, b := range rq.Distribution {
+			buckets = append(buckets, &SizeBucket{
+				InputTokens:  b.InputTokens,
+				OutputTokens: b.OutputTokens,
+				Weight:       float32(fraction * float64(b.Weight) / sumBucketWeights),
+			})
+		}
+	}
+	combined := &RequestSize{
+		AvgInputTokens:  float32(inTokens),
+		AvgOutputTokens: float32(outTokens),
+	}
+	if withDistribution {
+		combined.Distribution = buckets
+	}
+	return combined, nil
+}
+
 // check validity of request size
 func (rq *RequestSize) check() error {
 	if rq.AvgInputTokens < 0 || rq.AvgOutputTokens < 1 {
 		return fmt.Errorf("invalid request size %s", rq)
 	}
+	if len(rq.Distribution) == 0 && rq.AvgInputTokens == 0 && rq.AvgOutputTokens <= 1 {
+		return fmt.Errorf("request size %s has no work, needs input tokens or more than one output token", rq)
+	}
+	for _, b := range rq.Distribution {
+		if b == nil || b.InputTokens < 0 || b.OutputTokens < 1 || b.Weight <= 0 {
+			return fmt.Errorf("invalid request size bucket %s", b)
+		}
+	}
+	return nil
+}
+
+// check validity of request class
+func (c *WorkloadClass) check() error {
+	if c == nil {
+		return fmt.Errorf("missing request class")
+	}
+	if c.RequestSize == nil || c.ArrivalFraction <= 0 {
+		return fmt.Errorf("invalid request class %s", c)
+	}
+	if err := c.RequestSize.check(); err != nil {
+		return fmt.Errorf("invalid request class %q: %v", c.Name, err)
+	}
+	return nil
+}
+
+// value of an optional target (e.g. of OptionalTargetPerf)
+func TargetValue(value float32) *float32 {
+	return &value
+}
+
+// optional targets of target values, nil where zero (not considered)
+func (targetPerf *TargetPerf) Optional() *OptionalTargetPerf {
+	optional := func(value float32) *float32 {
+		if value == 0 {
+			return nil
+		}
+		return TargetValue(value)
+	}
+	return &OptionalTargetPerf{
+		TargetTTFT: optional(targetPerf.TargetTTFT),
+		TargetITL:  optional(targetPerf.TargetITL),
+		TargetTPS:  optional(targetPerf.TargetTPS),
+	}
+}
+
+// end-to-end latency (msec) of a request meeting the TTFT and ITL targets, TTFT + (outputTokens - 1) * ITL, given the
+// average number of output tokens (targets not considered, zero, contribute nothing)
+func (targetPerf *TargetPerf) EndToEndLatency(requestSize *RequestSize) float32 {
+	return targetPerf.TargetTTFT + max(requestSize.AvgOutputTokens-1, 0)*targetPerf.TargetITL
+}
+
+// TTFT and ITL targets splitting an end-to-end latency target (msec) of a request, a fraction for TTFT and the rest
+// for ITL over the tokens after the first, given the average number of output tokens (inverse of EndToEndLatency)
+//   - latency positive, fraction in (0, 1]
+//   - with at most one output token, all the latency is TTFT (ITL not considered)
+func TargetPerfFromE2E(latencyMs float32, ttftFraction float32, requestSize *RequestSize) (*TargetPerf, error) {
+	if latencyMs <= 0 || ttftFraction <= 0 || ttftFraction > 1 || requestSize == nil {
+		return nil, fmt.Errorf("invalid end-to-end latency %v, TTFT fraction %v, or missing request size", latencyMs, ttftFraction)
+	}
+	if err := requestSize.check(); err != nil {
+		return nil, err
+	}
+	decodeTokens := requestSize.AvgOutputTokens - 1
+	if decodeTokens <= 0 {
+		return &TargetPerf{TargetTTFT: latencyMs}, nil
+	}
+	return &TargetPerf{
+		TargetTTFT: latencyMs * ttftFraction,
+		TargetITL:  latencyMs * (1 - ttftFraction) / decodeTokens,
+	}, nil
+}
+
+// check validity of optional target values, set values non-negative
+func (targetPerf *OptionalTargetPerf) check() error {
+	for _, target := range []*float32{targetPerf.TargetTTFT, targetPerf.TargetITL, targetPerf.TargetTPS} {
+		if target != nil && *target < 0 {
+			return fmt.Errorf("invalid target data values %s", targetPerf)
+		}
+	}
 	return nil
 }
 
@@ -29,35 +433,342 @@ func (targetPerf *TargetPerf) check() error {
 	return nil
 }
 
+// check if achieved values meet targets (zero targets not considered)
+func (targetPerf *TargetPerf) isAchieved(achieved *TargetPerf) bool {
+	return (targetPerf.TargetTTFT == 0 || achieved.TargetTTFT <= targetPerf.TargetTTFT) &&
+		(targetPerf.TargetITL == 0 || achieved.TargetITL <= targetPerf.TargetITL) &&
+		(targetPerf.TargetTPS == 0 || achieved.TargetTPS >= targetPerf.TargetTPS)
+}
+
+// hint rate selected from the sizing hint (zero if no hint)
+func (o *SizeOptions) hint(selector func(*TargetRate) float32) float32 {
+	if o.Hint == nil {
+		return 0
+	}
+	return selector(o.Hint)
+}
+
+// check validity of sizing options
+func (o *SizeOptions) check() error {
+	if o.Tolerance < 0 || o.MaxIterations < 0 {
+		return fmt.Errorf("invalid sizing options: tolerance=%v, maxIterations=%d", o.Tolerance, o.MaxIterations)
+	}
+	return nil
+}
+
+// search parameters for a target given sizing options, defaults for unset values
+func (o *SizeOptions) searchParms(target string) *utils.SearchParms {
+	parms := utils.DefaultSearchParms()
+	if o.Trace != nil {
+		parms.Trace = func(lambda float32, value float32) {
+			o.Trace(target, lambda*1000, value)
+		}
+	}
+	if o.Tolerance > 0 {
+		parms.Tolerance = o.Tolerance
+	}
+	if o.MaxIterations > 0 {
+		parms.MaxIterations = o.MaxIterations
+	}
+	return parms
+}
+
+/*
+ * deep copy functions
+ */
+
+// timing models are shared, not copied
+func (sp *ServiceParms) clone() *ServiceParms {
+	c := &ServiceParms{PrefillModel: sp.PrefillModel, DecodeModel: sp.DecodeModel}
+	if sp.Prefill != nil {
+		prefill := *sp.Prefill
+		c.Prefill = &prefill
+	}
+	if sp.Decode != nil {
+		decode := *sp.Decode
+		decode.Breakpoints = slices.Clone(sp.Decode.Breakpoints)
+		decode.Slopes = slices.Clone(sp.Decode.Slopes)
+		c.Decode = &decode
+	}
+	if sp.Speculative != nil {
+		speculative := *sp.Speculative
+		c.Speculative = &speculative
+	}
+	return c
+}
+
+func (rq *RequestSize) clone() *RequestSize {
+	c := *rq
+	if rq.Distribution != nil {
+		c.Distribution = make([]*SizeBucket, len(rq.Distribution))
+		for i, b := range rq.Distribution {
+			bucket := *b
+			c.Distribution[i] = &bucket
+		}
+	}
+	return &c
+}
+
+/*
+ * JSON deserialization functions, validating decoded values
+ */
+
+func (c *Configuration) UnmarshalJSON(data []byte) error {
+	type configuration Configuration
+	var v configuration
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := (*Configuration)(&v).check(); err != nil {
+		return err
+	}
+	*c = Configuration(v)
+	return nil
+}
+
+func (rq *RequestSize) UnmarshalJSON(data []byte) error {
+	type requestSize RequestSize
+	var v requestSize
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := (*RequestSize)(&v).check(); err != nil {
+		return err
+	}
+	*rq = RequestSize(v)
+	return nil
+}
+
+// unmarshal a disaggregated configuration, checking each stage with the parameters it uses, so that the decode
+// parameters of the prefill stage and the prefill parameters of the decode stage may be omitted
+func (c *DisaggregatedConfiguration) UnmarshalJSON(data []byte) error {
+	type configuration Configuration
+	var v struct {
+		Prefill *configuration `json:"prefill"`
+		Decode  *configuration `json:"decode"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	config := DisaggregatedConfiguration{Prefill: (*Configuration)(v.Prefill), Decode: (*Configuration)(v.Decode)}
+	prefillConfig, decodeConfig, err := config.stages()
+	if err != nil {
+		return err
+	}
+	if err := prefillConfig.check(); err != nil {
+		return fmt.Errorf("prefill stage: %w", err)
+	}
+	if err := decodeConfig.check(); err != nil {
+		return fmt.Errorf("decode stage: %w", err)
+	}
+	*c = config
+	return nil
+}
+
+// performance metrics are equal to others within a tolerance (e.g. float32 noise in tests), all fields compared
+//   - numeric fields within the tolerance relative to the larger magnitude, absolute for magnitudes below one
+//     (e.g. zero drop rate against noise), other fields (regime) equal
+//   - fields are compared by reflection, so that metrics added to the struct are compared too
+func (am *AnalysisMetrics) ApproxEqual(other *AnalysisMetrics, tol float32) bool {
+	if am == nil || other == nil {
+		return am == other
+	}
+	v, w := reflect.ValueOf(am).Elem(), reflect.ValueOf(other).Elem()
+	for i := range v.NumField() {
+		x, y := v.Field(i), w.Field(i)
+		if x.CanFloat() {
+			a, b := x.Float(), y.Float()
+			if math.Abs(a-b) > float64(tol)*max(1, math.Abs(a), math.Abs(b)) {
+				return false
+			}
+		} else if !x.Equal(y) {
+			return false
+		}
+	}
+	return true
+}
+
+// performance metrics of latency and throughput, weighted equally in the score of relative errors
+var (
+	latencyMetrics = []string{"AvgRespTime", "AvgWaitTime", "P95RespTime", "P99RespTime", "AvgPrefillTime", "AvgTTFT",
+		"AvgTokenTime", "P95TokenTime", "P99TokenTime"}
+	throughputMetrics = []string{"Throughput", "Goodput", "DropRate", "MaxRate"}
+)
+
+// relative errors of predicted performance metrics against observed ones (e.g. golden measurements in regression tests), returns
+//   - relative error (predicted - observed) / observed of each numeric field observed (non-zero), by field name, signed
+//     (positive if over-predicted); fields observed as zero are taken as not measured
+//   - score, the average of the mean absolute relative errors of the observed latency and throughput metrics, so that
+//     latency and throughput weigh equally however many fields of each are observed; other metrics (e.g. occupancy,
+//     utilization, cost) follow from latency and throughput (Little's law) and are reported but not scored
+//   - an error if no latency or throughput metric is observed
+func RelativeErrors(predicted *AnalysisMetrics, observed *AnalysisMetrics) (fieldErrors map[string]float32, score float32, err error) {
+	if predicted == nil || observed == nil {
+		return nil, 0, fmt.Errorf("missing predicted or observed metrics")
+	}
+	p, o := reflect.ValueOf(predicted).Elem(), reflect.ValueOf(observed).Elem()
+	fieldErrors = make(map[string]float32)
+	for i := range o.NumField() {
+		if x := o.Field(i); x.CanFloat() && x.Float() != 0 {
+			fieldErrors[o.Type().Field(i).Name] = float32((p.Field(i).Float() - x.Float()) / x.Float())
+		}
+	}
+	var sum float32
+	var groups int
+	for _, names := range [][]string{latencyMetrics, throughputMetrics} {
+		var groupSum float32
+		var n int
+		for _, name := range names {
+			if e, ok := fieldErrors[name]; ok {
+				groupSum += float32(math.Abs(float64(e)))
+				n++
+			}
+		}
+		if n > 0 {
+			sum += groupSum / float32(n)
+			groups++
+		}
+	}
+	if groups == 0 {
+		return nil, 0, fmt.Errorf("no latency or throughput metrics observed %s", observed)
+	}
+	return fieldErrors, sum / float32(groups), nil
+}
+
 /*
  * toString() functions
  */
 
 func (c *Configuration) String() string {
-	return fmt.Sprintf("{maxBatch=%d, maxQueue=%d, servParms:%s}",
-		c.MaxBatchSize, c.MaxQueueSize, c.ServiceParms)
+	if c.KVCache != nil {
+		return fmt.Sprintf("{maxBatch=%d, maxQueue=%d, lossOnly=%v%s, unbounded=%v, replicas=%d, servParms:%s, kvCache:%s}",
+			c.MaxBatchSize, c.MaxQueueSize, c.LossOnly, optionalFieldsString(c), c.Unbounded, c.Replicas, c.ServiceParms, c.KVCache)
+	}
+	return fmt.Sprintf("{maxBatch=%d, maxQueue=%d, lossOnly=%v%s, unbounded=%v, replicas=%d, servParms:%s}",
+		c.MaxBatchSize, c.MaxQueueSize, c.LossOnly, optionalFieldsString(c), c.Unbounded, c.Replicas, c.ServiceParms)
 }
 
 func (qa *QueueAnalyzer) String() string {
-	return fmt.Sprintf("{maxBatch=%d, maxQueue=%d, servParms:%s, reqSize:%s, model:%s, rates:%s}",
-		qa.MaxBatchSize, qa.MaxQueueSize, qa.ServiceParms, qa.RequestSize, qa.Model, qa.RateRange)
+	if qa.KVCache != nil {
+		return fmt.Sprintf("{maxBatch=%d, configMaxBatch=%d, kvCache:%s, maxQueue=%d, lossOnly=%v%s, unbounded=%v, replicas=%d, servParms:%s, reqSize:%s, model:%s, rates:%s}",
+			qa.MaxBatchSize, qa.ConfigMaxBatchSize, qa.KVCache, qa.MaxQueueSize, qa.LossOnly, optionalFieldsString(qa.configuration()), qa.Unbounded, qa.Replicas,
+			qa.ServiceParms, qa.RequestSize, qa.Model, qa.RateRange)
+	}
+	return fmt.Sprintf("{maxBatch=%d, maxQueue=%d, lossOnly=%v%s, unbounded=%v, replicas=%d, servParms:%s, reqSize:%s, model:%s, rates:%s}",
+		qa.MaxBatchSize, qa.MaxQueueSize, qa.LossOnly, optionalFieldsString(qa.configuration()), qa.Unbounded, qa.Replicas, qa.ServiceParms, qa.RequestSize, qa.Model, qa.RateRange)
+}
+
+// optional fields of a configuration string, fractional max batch size, prefill concurrency limit, batch ceilings of
+// prefill and decode, and arrival variability, empty if not set (integer max batch size, not limited, Poisson arrivals)
+func optionalFieldsString(c *Configuration) string {
+	var s string
+	if c.FractionalMaxBatch != 0 {
+		s += fmt.Sprintf(", fractionalMaxBatch=%v", c.FractionalMaxBatch)
+	}
+	if c.MaxPrefillConcurrency != 0 {
+		s += fmt.Sprintf(", maxPrefill=%d", c.MaxPrefillConcurrency)
+	}
+	if c.MaxPrefillBatch != 0 {
+		s += fmt.Sprintf(", maxPrefillBatch=%d", c.MaxPrefillBatch)
+	}
+	if c.MaxDecodeBatch != 0 {
+		s += fmt.Sprintf(", maxDecodeBatch=%d", c.MaxDecodeBatch)
+	}
+	if c.ArrivalSCV != 0 && c.ArrivalSCV != 1 {
+		s += fmt.Sprintf(", arrivalSCV=%v", c.ArrivalSCV)
+	}
+	return s
+}
+
+func (o *AnalyzerOptions) String() string {
+	s := fmt.Sprintf("{epsilon=%.5f, stabilitySafetyFraction=%.3f", o.Epsilon, o.StabilitySafetyFraction)
+	if o.MaxBatchSizeLimit != 0 {
+		s += fmt.Sprintf(", maxBatchSizeLimit=%d", o.MaxBatchSizeLimit)
+	}
+	if o.MaxQueueSizeLimit != 0 {
+		s += fmt.Sprintf(", maxQueueSizeLimit=%d", o.MaxQueueSizeLimit)
+	}
+	if o.LinearSolver {
+		s += ", linearSolver=true"
+	}
+	if o.LowerMargin != 0 || o.UpperMargin != 0 {
+		lower, upper := o.margins()
+		s += fmt.Sprintf(", margins=[%.5f, %.5f]", lower, upper)
+	}
+	if o.UnderloadedLoad != 0 || o.NearSaturationLoad != 0 || o.SaturatedLoad != 0 {
+		underloaded, nearSaturation, saturated := o.regimeThresholds()
+		s += fmt.Sprintf(", regimeThresholds=[%.3f, %.3f, %.3f]", underloaded, nearSaturation, saturated)
+	}
+	return s + "}"
 }
 
 func (sp *ServiceParms) String() string {
-	return fmt.Sprintf("{prefillParms=%s, decodeParms=%s}",
-		sp.Prefill, sp.Decode)
+	var parts []string
+	if sp.PrefillModel != nil {
+		parts = append(parts, fmt.Sprintf("prefillModel=%T", sp.PrefillModel))
+	} else {
+		parts = append(parts, fmt.Sprintf("prefillParms=%s", sp.Prefill))
+	}
+	if sp.DecodeModel != nil {
+		parts = append(parts, fmt.Sprintf("decodeModel=%T", sp.DecodeModel))
+	} else {
+		parts = append(parts, fmt.Sprintf("decodeParms=%s", sp.Decode))
+	}
+	if sp.Speculative != nil {
+		parts = append(parts, fmt.Sprintf("speculativeParms=%s", sp.Speculative))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
 }
 
 func (p *PrefillParms) String() string {
-	return fmt.Sprintf("{gamma=%.3f, delta=%.5f}", p.Gamma, p.Delta)
+	s := fmt.Sprintf("{gamma=%.3f, delta=%.5f", p.Gamma, p.Delta)
+	if p.ChunkSize > 0 {
+		s += fmt.Sprintf(", chunkSize=%d", p.ChunkSize)
+	}
+	if p.CacheHitRate > 0 {
+		s += fmt.Sprintf(", cacheHitRate=%.3f", p.CacheHitRate)
+	}
+	return s + "}"
 }
 
 func (p *DecodeParms) String() string {
-	return fmt.Sprintf("{alpha=%.3f, beta=%.5f}", p.Alpha, p.Beta)
+	var position string
+	if p.PositionSlope != 0 {
+		position = fmt.Sprintf(", positionSlope=%v", p.PositionSlope)
+	}
+	if len(p.Breakpoints) > 0 {
+		return fmt.Sprintf("{alpha=%.3f, breakpoints=%v, slopes=%v%s}", p.Alpha, p.Breakpoints, p.Slopes, position)
+	}
+	return fmt.Sprintf("{alpha=%.3f, beta=%.5f%s}", p.Alpha, p.Beta, position)
+}
+
+func (k *KVCacheParms) String() string {
+	return fmt.Sprintf("{memoryBudget=%v, bytesPerToken=%v}", k.MemoryBudget, k.BytesPerToken)
+}
+
+func (s *SpeculativeParms) String() string {
+	return fmt.Sprintf("{acceptanceRate=%.3f, draftLength=%d}", s.AcceptanceRate, s.DraftLength)
 }
 
 func (rq *RequestSize) String() string {
-	return fmt.Sprintf("{inTokens=%d, outTokens=%d}", rq.AvgInputTokens, rq.AvgOutputTokens)
+	if len(rq.Distribution) > 0 {
+		return fmt.Sprintf("{inTokens=%v, outTokens=%v, dist=%v}", rq.AvgInputTokens, rq.AvgOutputTokens, rq.Distribution)
+	}
+	return fmt.Sprintf("{inTokens=%v, outTokens=%v}", rq.AvgInputTokens, rq.AvgOutputTokens)
+}
+
+func (b *SizeBucket) String() string {
+	return fmt.Sprintf("{inTokens=%d, outTokens=%d, weight=%.3f}", b.InputTokens, b.OutputTokens, b.Weight)
+}
+
+func (tp *OptionalTargetPerf) String() string {
+	value := func(target *float32) string {
+		if target == nil {
+			return "none"
+		}
+		return fmt.Sprintf("%.3f", *target)
+	}
+	return fmt.Sprintf("{TTFT=%s, ITL=%s, TPS=%s}", value(tp.TargetTTFT), value(tp.TargetITL), value(tp.TargetTPS))
 }
 
 func (rr *RateRange) String() string {
@@ -65,8 +776,8 @@ func (rr *RateRange) String() string {
 }
 
 func (am *AnalysisMetrics) String() string {
-	return fmt.Sprintf("{tput=%.3f, lat=%.3f, wait=%.3f, conc=%.3f, prefill=%.3f, itl=%.3f, maxRate=%.3f, rho=%0.3f}",
-		am.Throughput, am.AvgRespTime, am.AvgWaitTime, am.AvgNumInServ, am.AvgPrefillTime, am.AvgTokenTime, am.MaxRate, am.Rho)
+	return fmt.Sprintf("{offered=%.3f, tput=%.3f, tputSD=%.3f, goodput=%.3f, drop=%.3f, pBlock=%.5f, lat=%.3f, p95=%.3f, p99=%.3f, wait=%.3f, conc=%.3f, queue=%.3f, effConc=%.3f, prefill=%.3f, ttft=%.3f, itl=%.3f, p95itl=%.3f, p99itl=%.3f, maxRate=%.3f, rho=%0.3f, regime=%s, idle=%t, costReq=%.5f, costMTokens=%.3f}",
+		am.OfferedRate, am.Throughput, am.ThroughputStdDev, am.Goodput, am.DropRate, am.PBlock, am.AvgRespTime, am.P95RespTime, am.P99RespTime, am.AvgWaitTime, am.AvgNumInServ, am.AvgQueueLength, am.EffConc, am.AvgPrefillTime, am.AvgTTFT, am.AvgTokenTime, am.P95TokenTime, am.P99TokenTime, am.MaxRate, am.Rho, am.Regime, am.Idle, am.CostPerRequest, am.CostPerMillionTokens)
 }
 
 func (tp *TargetPerf) String() string {
@@ -75,6 +786,47 @@ func (tp *TargetPerf) String() string {
 }
 
 func (tr *TargetRate) String() string {
-	return fmt.Sprintf("{rateTTFT=%.3f, rateITL=%.3f, rateTPS=%.3f}",
-		tr.RateTargetTTFT, tr.RateTargetITL, tr.RateTargetTPS)
+	return fmt.Sprintf("{rateTTFT=%.3f, rateITL=%.3f, rateTPS=%.3f, rate=%.3f, binding=%s}",
+		tr.RateTargetTTFT, tr.RateTargetITL, tr.RateTargetTPS, tr.Rate, tr.Binding)
+}
+
+func (c *WorkloadClass) String() string {
+	return fmt.Sprintf("{name=%s, reqSize:%s, fraction=%.3f}", c.Name, c.RequestSize, c.ArrivalFraction)
+}
+
+func (mm *MultiClassMetrics) String() string {
+	return fmt.Sprintf("{aggregate:%s, classes:%v}", mm.Aggregate, mm.Classes)
+}
+
+func (cm *ClassMetrics) String() string {
+	return fmt.Sprintf("{name=%s, tput=%.3f, lat=%.3f, prefill=%.3f, ttft=%.3f, itl=%.3f}",
+		cm.Name, cm.Throughput, cm.AvgRespTime, cm.AvgPrefillTime, cm.TTFT, cm.ITL)
+}
+
+func (e *TargetInfeasibleError) Error() string {
+	return fmt.Sprintf("%v: target%s=%v, achievable range=[%v, %v]", ErrTargetInfeasible, e.Metric, e.Target, e.MinValue, e.MaxValue)
+}
+
+func (e *TargetInfeasibleError) Unwrap() error {
+	return ErrTargetInfeasible
+}
+
+func (e *RateExceedsMaxError) Error() string {
+	return fmt.Sprintf("%v: rate=%v, max allowed rate=%v, overload=%v", ErrRateExceedsMax, e.Rate, e.MaxRate, e.Overload)
+}
+
+func (e *RateExceedsMaxError) Unwrap() error {
+	return ErrRateExceedsMax
+}
+
+func (c *DisaggregatedConfiguration) String() string {
+	if c == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("{prefill:%s, decode:%s}", c.Prefill, c.Decode)
+}
+
+func (dm *DisaggregatedMetrics) String() string {
+	return fmt.Sprintf("{offered=%.3f, tput=%.3f, lat=%.3f, ttft=%.3f, itl=%.3f, maxRate=%.3f, prefill:%s, decode:%s}",
+		dm.OfferedRate, dm.Throughput, dm.AvgRespTime, dm.AvgTTFT, dm.AvgTokenTime, dm.MaxRate, dm.Prefill, dm.Decode)
 }
@@ -0,0 +1,133 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// configurations and request sizes marshaled to JSON unmarshal to the originals
+func TestJSONRoundTrip(t *testing.T) {
+	withOptions := testConfig(64, 100)
+	withOptions.Replicas = 3
+	withOptions.CostPerSecond = 0.002
+	withOptions.KVCache = &KVCacheParms{MemoryBudget: 40e9, BytesPerToken: 160e3}
+	withOptions.Options = &AnalyzerOptions{Epsilon: 0.01, StabilitySafetyFraction: 0.2, LinearSolver: true}
+	tabulated := testConfig(256, 0)
+	tabulated.LossOnly = true
+	tabulated.ServiceParms.Decode = &DecodeParms{Alpha: 6.958, Breakpoints: []float32{0, 64}, Slopes: []float32{0.04, 0.06}}
+	tabulated.ServiceParms.Speculative = &SpeculativeParms{AcceptanceRate: 0.7, DraftLength: 4}
+
+	tests := []struct {
+		name    string
+		value   any
+		decoded func() any
+	}{
+		{"configuration", testConfig(256, 100), func() any { return &Configuration{} }},
+		{"configuration with options", withOptions, func() any { return &Configuration{} }},
+		{"configuration tabulated speculative", tabulated, func() any { return &Configuration{} }},
+		{"request size", NewRequestSize(128, 512), func() any { return &RequestSize{} }},
+		{"request size distribution", &RequestSize{AvgInputTokens: 150, AvgOutputTokens: 300,
+			Distribution: []*SizeBucket{{100, 200, 1}, {200, 400, 1}}}, func() any { return &RequestSize{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			decoded := tt.decoded()
+			if err := json.Unmarshal(data, decoded); err != nil {
+				t.Fatalf("unmarshal %s: %v", data, err)
+			}
+			if !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("round trip of %s gives %v, expected %v", data, decoded, tt.value)
+			}
+		})
+	}
+}
+
+// invalid configurations and request sizes are rejected when unmarshaled, with the target unchanged
+func TestJSONRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		decoded any
+	}{
+		{"zero max batch size", `{"maxBatchSize": 0, "maxQueueSize": 10,
+			"serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}, "decode": {"alpha": 7, "beta": 0.04}}}`, &Configuration{}},
+		{"negative max queue size", `{"maxBatchSize": 8, "maxQueueSize": -1,
+			"serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}, "decode": {"alpha": 7, "beta": 0.04}}}`, &Configuration{}},
+		{"missing service parameters", `{"maxBatchSize": 8, "maxQueueSize": 10}`, &Configuration{}},
+		{"missing decode parameters", `{"maxBatchSize": 8, "maxQueueSize": 10,
+			"serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}}}`, &Configuration{}},
+		{"loss-only and unbounded", `{"maxBatchSize": 8, "maxQueueSize": 0, "lossOnly": true, "unbounded": true,
+			"serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}, "decode": {"alpha": 7, "beta": 0.04}}}`, &Configuration{}},
+		{"wrong type", `{"maxBatchSize": "eight"}`, &Configuration{}},
+		{"negative output tokens", `{"avgInputTokens": 128, "avgOutputTokens": -1}`, &RequestSize{}},
+		{"no tokens", `{"avgInputTokens": 0, "avgOutputTokens": 0}`, &RequestSize{}},
+		{"malformed", `{"avgInputTokens": 128,`, &RequestSize{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zero := reflect.New(reflect.TypeOf(tt.decoded).Elem()).Interface()
+			if err := json.Unmarshal([]byte(tt.data), tt.decoded); err == nil {
+				t.Fatalf("unmarshal of %s accepted as %v", tt.data, tt.decoded)
+			}
+			if !reflect.DeepEqual(tt.decoded, zero) {
+				t.Errorf("unmarshal of %s modified target to %v", tt.data, tt.decoded)
+			}
+		})
+	}
+}
+
+// disaggregated configurations unmarshal without the decode parameters of the prefill stage and the prefill parameters
+// of the decode stage, which are unused, and are rejected without the parameters a stage uses
+func TestJSONDisaggregated(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"stage parameters only", `{
+			"prefill": {"maxBatchSize": 8, "maxQueueSize": 10, "serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}}},
+			"decode": {"maxBatchSize": 64, "maxQueueSize": 10, "serviceParms": {"decode": {"alpha": 7, "beta": 0.04}}}}`, true},
+		{"all parameters", `{
+			"prefill": {"maxBatchSize": 8, "maxQueueSize": 10,
+				"serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}, "decode": {"alpha": 7, "beta": 0.04}}},
+			"decode": {"maxBatchSize": 64, "maxQueueSize": 10,
+				"serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}, "decode": {"alpha": 7, "beta": 0.04}}}}`, true},
+		{"missing prefill parameters", `{
+			"prefill": {"maxBatchSize": 8, "maxQueueSize": 10, "serviceParms": {"decode": {"alpha": 7, "beta": 0.04}}},
+			"decode": {"maxBatchSize": 64, "maxQueueSize": 10, "serviceParms": {"decode": {"alpha": 7, "beta": 0.04}}}}`, false},
+		{"missing decode parameters", `{
+			"prefill": {"maxBatchSize": 8, "maxQueueSize": 10, "serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}}},
+			"decode": {"maxBatchSize": 64, "maxQueueSize": 10, "serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}}}}`, false},
+		{"invalid prefill stage", `{
+			"prefill": {"maxBatchSize": 0, "maxQueueSize": 10, "serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}}},
+			"decode": {"maxBatchSize": 64, "maxQueueSize": 10, "serviceParms": {"decode": {"alpha": 7, "beta": 0.04}}}}`, false},
+		{"missing decode stage", `{
+			"prefill": {"maxBatchSize": 8, "maxQueueSize": 10, "serviceParms": {"prefill": {"gamma": 86, "delta": 0.001}}}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config DisaggregatedConfiguration
+			err := json.Unmarshal([]byte(tt.data), &config)
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("unmarshal accepted %s", &config)
+				}
+				if config.Prefill != nil || config.Decode != nil {
+					t.Errorf("unmarshal modified target to %s", &config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if _, err := NewDisaggregatedAnalyzer(&config, NewRequestSize(128, 512)); err != nil {
+				t.Errorf("failed to create analyzer of %s: %v", &config, err)
+			}
+		})
+	}
+}
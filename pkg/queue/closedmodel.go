@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// closed (finite population) model with state dependent service rate: a fixed number of clients, each alternating
+// between thinking (exponential think time) and a request to the server, e.g. a load generator at fixed concurrency
+//   - state n is the number of requests in the system, the arrival rate in state n is (clients - n) / think time
+//   - at most K requests are in the system, a client arriving at a full system is rejected and thinks again
+//   - with zero think time, clients (up to K) are always in the system, a completed request is replaced at once
+type ClosedModelStateDependent struct {
+	QueueModel                // extends base class, lambda is the throughput (rate of admitted requests)
+	K               int       // occupancy bound
+	servRate        []float32 // state-dependent service rate
+	clients         int       // number of clients
+	thinkTime       float64   // average think time of a client
+	p               []float64 // state probabilities
+	offeredRate     float64   // rate of arrivals, admitted or rejected
+	avgNumInServers float64
+}
+
+func NewClosedModelStateDependent(K int, servRate []float32) *ClosedModelStateDependent {
+	return &ClosedModelStateDependent{
+		K:        K,
+		servRate: servRate,
+		p:        make([]float64, K+1),
+	}
+}
+
+// Solve queueing model given the number of clients and their average think time
+func (m *ClosedModelStateDependent) Solve(clients int, thinkTime float32) {
+	m.Reset()
+	m.clients = clients
+	m.thinkTime = float64(thinkTime)
+	if clients <= 0 || thinkTime < 0 || m.K <= 0 || len(m.servRate) == 0 {
+		return
+	}
+	m.isValid = true
+	m.computeProbabilities()
+	m.computeStatistics()
+}
+
+// Solve queueing model given the number of clients and their average think time, returning the result of the solution,
+// with an error if invalid
+func (m *ClosedModelStateDependent) SolveChecked(clients int, thinkTime float32) (*SolveResult, error) {
+	m.Solve(clients, thinkTime)
+	return m.result()
+}
+
+// Reset model to its unsolved state, clearing results of a previous solution
+func (m *ClosedModelStateDependent) Reset() {
+	m.QueueModel.Reset()
+	m.clients = 0
+	m.thinkTime = 0
+	clear(m.p)
+	m.offeredRate = 0
+	m.avgNumInServers = 0
+}
+
+// service rate in state n > 0
+func (m *ClosedModelStateDependent) serviceRate(n int) float64 {
+	return float64(m.servRate[min(n, len(m.servRate))-1])
+}
+
+// highest reachable state
+func (m *ClosedModelStateDependent) top() int {
+	return min(m.clients, m.K)
+}
+
+// Compute state probabilities
+//   - p[n+1] = p[n] * (clients - n) / (thinkTime * servRate(n+1)), products of ratios computed as sums of logarithms,
+//     as they may overflow for many clients and short think times
+func (m *ClosedModelStateDependent) computeProbabilities() {
+	top := m.top()
+	if m.thinkTime == 0 {
+		m.p[top] = 1
+		return
+	}
+	logP := make([]float64, top+1)
+	maxLogP := 0.0
+	for n := 0; n < top; n++ {
+		logP[n+1] = logP[n] + math.Log(float64(m.clients-n)/(m.thinkTime*m.serviceRate(n+1)))
+		maxLogP = max(maxLogP, logP[n+1])
+	}
+	var sum float64
+	for n := 0; n <= top; n++ {
+		m.p[n] = math.Exp(logP[n] - maxLogP)
+		sum += m.p[n]
+	}
+	for n := 0; n <= top; n++ {
+		m.p[n] /= sum
+	}
+}
+
+// Evaluate performance measures of queueing model
+func (m *ClosedModelStateDependent) computeStatistics() {
+	top := m.top()
+	num := len(m.servRate)
+	var departureRate, throughput, offeredRate float64
+	var avgNumInSystem, avgNumInServers, avgQueueLength float64
+	for n := 0; n <= top; n++ {
+		p := m.p[n]
+		avgNumInSystem += float64(n) * p
+		avgNumInServers += float64(min(n, num)) * p
+		avgQueueLength += float64(max(n-num, 0)) * p
+		if n > 0 {
+			departureRate += p * m.serviceRate(n)
+		}
+		if m.thinkTime > 0 {
+			arrivalRate := p * float64(m.clients-n) / m.thinkTime
+			offeredRate += arrivalRate
+			if n < top {
+				throughput += arrivalRate
+			}
+		}
+	}
+	if m.thinkTime == 0 {
+		// completed requests are replaced at once, without rejections
+		throughput = departureRate
+		offeredRate = departureRate
+	}
+	if throughput <= 0 {
+		m.isValid = false
+		return
+	}
+	m.lambda = throughput
+	m.rho = 1 - m.p[0]
+	m.offeredRate = offeredRate
+	m.avgNumInServers = avgNumInServers
+	m.avgNumInSystem = avgNumInSystem
+	m.avgQueueLength = avgQueueLength
+	m.avgRespTime = avgNumInSystem / throughput
+	m.avgServTime = avgNumInServers / throughput
+	m.avgWaitTime = max(m.avgRespTime-m.avgServTime, 0)
+	var cutImbalance float64
+	if m.thinkTime > 0 {
+		// with zero think time, all probability is in the highest reachable state, with no flows between states
+		arrivalRate := func(n int) float64 { return float64(m.clients-n) / m.thinkTime }
+		cutImbalance = maxCutImbalance(m.p, top, arrivalRate, m.serviceRate)
+	}
+	m.checkConsistency(cutImbalance, departureRate, throughput)
+}
+
+// Get the number of clients of the last solution
+func (m *ClosedModelStateDependent) GetClients() int {
+	return m.clients
+}
+
+// Get the average think time of the last solution
+func (m *ClosedModelStateDependent) GetThinkTime() float32 {
+	return float32(m.thinkTime)
+}
+
+// Get throughput, the rate of admitted requests
+func (m *ClosedModelStateDependent) GetThroughput() float32 {
+	return float32(m.lambda)
+}
+
+// Get the rate of arrivals of clients, admitted or rejected
+func (m *ClosedModelStateDependent) GetOfferedRate() float32 {
+	return float32(m.offeredRate)
+}
+
+// Probability that an arrival finds the system full and is rejected
+func (m *ClosedModelStateDependent) GetBlockingProbability() float32 {
+	if !m.isValid || m.offeredRate <= 0 {
+		return 0
+	}
+	return float32(max(1-m.lambda/m.offeredRate, 0))
+}
+
+func (m *ClosedModelStateDependent) GetAvgNumInServers() float32 {
+	return float32(m.avgNumInServers)
+}
+
+// Get a copy of the state probabilities, p[i] = Probability[system has exactly i customers], i=0,1,...,K
+func (m *ClosedModelStateDependent) GetStateProbabilities() []float32 {
+	if !m.isValid {
+		return nil
+	}
+	probs := make([]float32, m.K+1)
+	for i, p := range m.p {
+		probs[i] = float32(p)
+	}
+	return probs
+}
+
+// Get probability that all servers are busy (system has at least as many customers as servers)
+func (m *ClosedModelStateDependent) GetProbBatchFull() float32 {
+	if !m.isValid {
+		return 0
+	}
+	var sum float64
+	for i := len(m.servRate); i <= m.K; i++ {
+		sum += m.p[i]
+	}
+	return float32(sum)
+}
+
+func (m *ClosedModelStateDependent) String() string {
+	var b bytes.Buffer
+	b.WriteString("ClosedModelStateDependent: ")
+	fmt.Fprintf(&b, "K=%d; clients=%d; thinkTime=%v; ", m.K, m.clients, m.GetThinkTime())
+	b.WriteString(m.QueueModel.String())
+	return b.String()
+}
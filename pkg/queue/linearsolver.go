@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+)
+
+// Solve a tridiagonal linear system by Gaussian elimination with partial pivoting (as LAPACK gtsv)
+//   - dl, d, du are the sub-diagonal (n-1), diagonal (n), and super-diagonal (n-1) of the matrix
+//   - b is the right-hand side (n), overwritten by the solution
+//   - dl, d, du are overwritten by the factorization (dl holding fill-in of row interchanges)
+func solveTridiagonal(dl []float64, d []float64, du []float64, b []float64) error {
+	n := len(d)
+	if n == 0 || len(b) != n || len(dl) != n-1 || len(du) != n-1 {
+		return fmt.Errorf("invalid tridiagonal system of size %d", n)
+	}
+	for i := 0; i < n-1; i++ {
+		if math.Abs(d[i]) >= math.Abs(dl[i]) {
+			// no row interchange
+			if d[i] == 0 {
+				return fmt.Errorf("singular tridiagonal system at row %d", i)
+			}
+			fact := dl[i] / d[i]
+			d[i+1] -= fact * du[i]
+			b[i+1] -= fact * b[i]
+			dl[i] = 0
+			continue
+		}
+		// interchange rows i and i+1
+		fact := d[i] / dl[i]
+		d[i] = dl[i]
+		temp := d[i+1]
+		d[i+1] = du[i] - fact*temp
+		if i < n-2 {
+			dl[i] = du[i+1]
+			du[i+1] = -fact * dl[i]
+		} else {
+			dl[i] = 0
+		}
+		du[i] = temp
+		b[i], b[i+1] = b[i+1], b[i]-fact*b[i+1]
+	}
+	if d[n-1] == 0 {
+		return fmt.Errorf("singular tridiagonal system at row %d", n-1)
+	}
+
+	// back substitution
+	b[n-1] /= d[n-1]
+	if n > 1 {
+		b[n-2] = (b[n-2] - du[n-2]*b[n-1]) / d[n-2]
+	}
+	for i := n - 3; i >= 0; i-- {
+		b[i] = (b[i] - du[i]*b[i+1] - dl[i]*b[i+2]) / d[i]
+	}
+	return nil
+}
@@ -0,0 +1,705 @@
+package queue
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// number of time steps per average response time when computing percentiles
+const numStepsPerMean = 1000
+
+// limit on the number of time steps when computing percentiles
+const maxPercentileSteps = 1000000
+
+// half width of window of significant Poisson terms, in standard deviations
+const poissonWindow = 10
+
+// number of milliseconds in a second
+//   - models of inference servers are solved with rates in requests/msec, hence times are in msec
+const MsecPerSecond = 1000
+
+// probability below which the geometric tail of an unbounded queue is truncated when computing percentiles
+const tailTruncation = 1e-12
+
+// number of state probabilities at each end of the probability vector shown in the string of diagnostics
+const diagnosticStates = 8
+
+// diagnostics of the last solution of a model with state dependent service rate, e.g. to debug an invalid solution
+// near saturation
+type Diagnostics struct {
+	Valid         bool      // solution valid
+	Lambda        float32   // arrival rate
+	ServiceRates  []float32 // state-dependent service rates
+	K             int       // occupancy bound (number of servers if unbounded)
+	Unbounded     bool      // unbounded queue, with a geometric tail beyond K
+	LinearSolver  bool      // solved as a linear system rather than by recurrence
+	Probabilities []float64 // state probabilities 0, 1, ..., K as last computed (possibly partial if the solution failed)
+	SumResidual   float64   // deviation from one of the sum of probabilities (including the geometric tail if unbounded)
+	Residual      float32   // largest relative residual of the consistency identities
+}
+
+// version of the encoding of a model (MarshalBinary), changed with the encoded state
+const modelStateVersion = 1
+
+// encoded state of a model with state dependent service rate
+type modelState struct {
+	Version         int
+	K               int
+	ServiceRates    []float32
+	Unbounded       bool
+	LinearSolver    bool
+	Valid           bool
+	Lambda          float64
+	Mu              float64
+	Rho             float64
+	AvgRespTime     float64
+	AvgWaitTime     float64
+	AvgServTime     float64
+	AvgNumInSystem  float64
+	AvgQueueLength  float64
+	AvgNumInServers float64
+	Residual        float64
+	Probabilities   []float64
+	SumP            float64
+	Throughput      float64
+}
+
+// M/M/1 model with state dependent service rate
+type MM1ModelStateDependent struct {
+	MM1KModel                 // extends base class
+	servRate        []float32 // state-dependent service rate
+	avgNumInServers float64
+	unbounded       bool      // unbounded queue, states above the number of servers have a geometric tail
+	linearSolver    bool      // state probabilities solved from the balance equations as a linear system, rather than by recurrence
+	work            []float64 // work space of the linear solver (diagonals and right-hand side), reused across solves
+}
+
+func NewMM1ModelStateDependent(K int, servRate []float32) *MM1ModelStateDependent {
+	m := &MM1ModelStateDependent{}
+	m.init(K, servRate)
+	return m
+}
+
+// initialize an unsolved model in place, binding the functions of the base class to the model
+func (m *MM1ModelStateDependent) init(K int, servRate []float32) {
+	*m = MM1ModelStateDependent{
+		MM1KModel: MM1KModel{K: K, p: make([]float64, K+1)},
+		servRate:  servRate,
+	}
+	m.QueueModel.ComputeRho = m.ComputeRho
+	m.QueueModel.computeStatistics = m.computeStatistics
+	// a finite chain has a stationary distribution at any arrival rate, utilization is known only once solved
+	m.QueueModel.GetRhoMax = func() float32 { return math.MaxFloat32 }
+}
+
+// M/M/1 model with state dependent service rate and an unbounded queue
+//   - the service rate beyond the number of servers (length of servRate) is constant,
+//     hence the stationary probabilities of states above it form a geometric tail, solved in closed form
+//   - probabilities are kept for states up to the number of servers (K)
+//   - the model is valid only if the arrival rate is below the service rate of all servers
+func NewMM1ModelStateDependentUnbounded(servRate []float32) *MM1ModelStateDependent {
+	m := NewMM1ModelStateDependent(len(servRate), servRate)
+	m.unbounded = true
+	// stability is checked against the service rate of all servers when solving
+	return m
+}
+
+// Create an independent copy of the model, including its solved state
+func (m *MM1ModelStateDependent) Clone() *MM1ModelStateDependent {
+	servRate := make([]float32, len(m.servRate))
+	copy(servRate, m.servRate)
+	var c *MM1ModelStateDependent
+	if m.unbounded {
+		c = NewMM1ModelStateDependentUnbounded(servRate)
+	} else {
+		c = NewMM1ModelStateDependent(m.K, servRate)
+	}
+	c.MM1KModel.copyState(&m.MM1KModel)
+	c.avgNumInServers = m.avgNumInServers
+	c.linearSolver = m.linearSolver
+	return c
+}
+
+// Solve state probabilities from the balance equations as a (tridiagonal) linear system, by Gaussian elimination
+// with partial pivoting, rather than by the product-form recurrence (default), e.g. for comparison
+//   - the recurrence multiplies ratios of rates (no cancellation) and rescales to avoid overflow,
+//     the linear system involves differences of rates and is not rescaled, hence may lose accuracy or overflow
+//     (model invalid) for large occupancy bounds under heavy load
+func (m *MM1ModelStateDependent) SetLinearSolver(linearSolver bool) {
+	m.linearSolver = linearSolver
+}
+
+// Check if state probabilities are solved as a linear system
+func (m *MM1ModelStateDependent) UsesLinearSolver() bool {
+	return m.linearSolver
+}
+
+// Check if queue is unbounded
+func (m *MM1ModelStateDependent) IsUnbounded() bool {
+	return m.unbounded
+}
+
+// ratio of probabilities of successive states in the geometric tail of an unbounded queue
+func (m *MM1ModelStateDependent) tailRatio() float64 {
+	return m.lambda / float64(m.servRate[len(m.servRate)-1])
+}
+
+// Solve queueing model given arrival and service rates
+func (m *MM1ModelStateDependent) Solve(lambda float32, mu float32) {
+	m.avgNumInServers = 0
+	m.MM1KModel.Solve(lambda, mu)
+}
+
+// Solve queueing model given arrival and service rates, returning the result of the solution, with an error if invalid
+func (m *MM1ModelStateDependent) SolveChecked(lambda float32, mu float32) (*SolveResult, error) {
+	m.Solve(lambda, mu)
+	return m.result()
+}
+
+// Reset model to its unsolved state, clearing results of a previous solution
+func (m *MM1ModelStateDependent) Reset() {
+	m.MM1KModel.Reset()
+	m.avgNumInServers = 0
+}
+
+// Compute utilization of queueing model
+func (m *MM1ModelStateDependent) ComputeRho() float32 {
+	return 1 - float32(m.p[0])
+}
+
+// Evaluate performance measures of queueing model
+func (m *MM1ModelStateDependent) computeStatistics() {
+	if !m.isValid {
+		return
+	}
+	if m.unbounded && m.tailRatio() >= 1 {
+		// no stationary solution
+		m.isValid = false
+		return
+	}
+	m.computeProbabilities()
+	if !m.isValid {
+		return
+	}
+
+	// calculate avgNumInServers and avgQueueLength
+	num := len(m.servRate)
+	var avgNumInServers float64
+	var avgNumInSystem float64
+	var avgQueueLength float64
+	sumP := m.p[0]
+	for i := 1; i <= m.K; i++ {
+		avgNumInSystem += float64(i) * m.p[i]
+		sumP += m.p[i]
+		if i == num {
+			avgNumInServers = avgNumInSystem + (1-sumP)*float64(num)
+		}
+		if i > num {
+			avgQueueLength += float64(i-num) * m.p[i]
+		}
+	}
+	if m.unbounded {
+		// geometric tail: p[K+j] = p[K] * r^j, j=1,2,...
+		r := m.tailRatio()
+		avgNumInSystem += m.p[m.K] * (float64(m.K)*r/(1-r) + r/((1-r)*(1-r)))
+		avgQueueLength = m.p[m.K] * r / ((1 - r) * (1 - r))
+	}
+	if !m.unbounded && m.K <= num {
+		// no waiting states (loss system), all customers are in service, hence waiting time is exactly zero
+		avgNumInServers = avgNumInSystem
+	}
+	m.avgNumInServers = avgNumInServers
+	m.avgNumInSystem = avgNumInSystem
+	m.avgQueueLength = avgQueueLength
+
+	m.throughput = m.lambda
+	if !m.unbounded {
+		m.throughput *= 1 - m.p[m.K]
+	}
+	m.avgRespTime = m.avgNumInSystem / m.throughput
+	m.avgServTime = m.avgNumInServers / m.throughput
+	m.avgWaitTime = m.avgRespTime - m.avgServTime
+	if m.avgWaitTime < 0 {
+		m.avgWaitTime = 0
+	}
+
+	// departure rate, including the geometric tail of an unbounded queue
+	serviceRate := func(n int) float64 {
+		return float64(m.servRate[min(n, num)-1])
+	}
+	var departureRate float64
+	for i := 1; i <= m.K; i++ {
+		departureRate += m.p[i] * serviceRate(i)
+	}
+	if m.unbounded {
+		tailProb := m.p[m.K] * m.tailRatio() / (1 - m.tailRatio())
+		departureRate += tailProb * serviceRate(num)
+	}
+	arrivalRate := func(int) float64 { return m.lambda }
+	m.checkConsistency(maxCutImbalance(m.p, m.K, arrivalRate, serviceRate), departureRate, m.throughput)
+}
+
+// Compute state probabilities
+func (m *MM1ModelStateDependent) computeProbabilities() {
+	// queue length distribution
+	// p[i] = Probability[system has exactly i customers]
+	m.p[0] = 1
+	scale := math.MaxFloat64 / float64(m.K)
+	if m.linearSolver {
+		if !m.solveBalanceEquations() {
+			m.isValid = false
+			return
+		}
+	} else {
+		var sRate float64
+		num := len(m.servRate)
+		for n := 0; n < m.K; n++ {
+			if n < num {
+				sRate = float64(m.servRate[n])
+			} else {
+				sRate = float64(m.servRate[num-1])
+			}
+			m.p[n+1] = m.p[n] * m.lambda / sRate
+			for m.p[n+1] < 0 || math.IsInf(m.p[n+1], 0) || math.IsNaN(m.p[n+1]) {
+				for i := 0; i <= n; i++ {
+					m.p[i] /= scale
+				}
+				m.p[n+1] = m.p[n] * m.lambda / sRate
+			}
+		}
+	}
+
+	// normalize queue length distribution
+	var sum float64
+	for n := 0; n <= m.K; n++ {
+		sum += m.p[n]
+		if sum < 0 || math.IsInf(sum, 0) {
+			sum = 0
+			for i := 0; i <= m.K; i++ {
+				m.p[i] /= scale
+				if i <= n {
+					sum += m.p[i]
+				}
+			}
+		}
+	}
+	if m.unbounded {
+		// mass of geometric tail beyond state K
+		r := m.tailRatio()
+		sum += m.p[m.K] * r / (1 - r)
+	}
+
+	// queue length distribution
+	m.sumP = 0
+	for n := 0; n <= m.K; n++ {
+		m.p[n] /= sum
+		m.sumP += m.p[n]
+	}
+
+	// calculate rho
+	m.rho = 1 - m.p[0]
+}
+
+// Solve the balance equations of states 1, ..., K for (unnormalized) probabilities, given p[0],
+// false if the linear system is singular or the solution is not finite
+//   - state n: lambda * p[n-1] - (lambda + mu[n]) * p[n] + mu[n+1] * p[n+1] = 0
+//   - state K: lambda * p[K-1] - mu[K] * p[K] = 0 (also with a geometric tail beyond K, as lambda = mu[K] * r)
+//   - unknowns are ordered from state K down to 1, as forward elimination in the natural order cancels
+//     (almost) all of the last pivot under heavy load
+func (m *MM1ModelStateDependent) solveBalanceEquations() bool {
+	num := len(m.servRate)
+	mu := func(n int) float64 {
+		return float64(m.servRate[min(n, num)-1])
+	}
+	lambda := m.lambda
+	if len(m.work) != 4*m.K-2 {
+		m.work = make([]float64, 4*m.K-2)
+	}
+	dl := m.work[:m.K-1]
+	d := m.work[m.K-1 : 2*m.K-1]
+	du := m.work[2*m.K-1 : 3*m.K-2]
+	b := m.work[3*m.K-2:]
+	clear(b)
+	// row i is the balance equation of state n = K - i, with unknown p[n]
+	for i := range d {
+		n := m.K - i
+		if n < m.K {
+			d[i] = -(lambda + mu(n))
+			dl[i-1] = mu(n + 1)
+		} else {
+			d[i] = -mu(n)
+		}
+		if n > 1 {
+			du[i] = lambda
+		}
+	}
+	b[m.K-1] = -lambda * m.p[0]
+	if err := solveTridiagonal(dl, d, du, b); err != nil {
+		return false
+	}
+	for i, x := range b {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return false
+		}
+		// negligible probabilities may underflow or round below zero
+		m.p[m.K-i] = max(x, 0)
+	}
+	return true
+}
+
+// Get throughput in requests/sec, assuming the model is solved with rates in requests/msec
+func (m *MM1ModelStateDependent) GetThroughputPerSecond() float32 {
+	return m.GetThroughput() * MsecPerSecond
+}
+
+// Get arrival rate in requests/sec, assuming the model is solved with rates in requests/msec
+func (m *MM1ModelStateDependent) GetLambdaPerSecond() float32 {
+	return m.GetLambda() * MsecPerSecond
+}
+
+// Get average response time in msec, assuming the model is solved with rates in requests/msec
+func (m *MM1ModelStateDependent) GetAvgRespTimeMsec() float32 {
+	return m.GetAvgRespTime()
+}
+
+// Get average waiting time in msec, assuming the model is solved with rates in requests/msec
+func (m *MM1ModelStateDependent) GetAvgWaitTimeMsec() float32 {
+	return m.GetAvgWaitTime()
+}
+
+// Get average service time in msec, assuming the model is solved with rates in requests/msec
+func (m *MM1ModelStateDependent) GetAvgServTimeMsec() float32 {
+	return m.GetAvgServTime()
+}
+
+// Solve model given arrival rate in requests/sec, with rates in requests/msec
+func (m *MM1ModelStateDependent) SolvePerSecond(lambdaPerSecond float32) {
+	m.Solve(lambdaPerSecond/MsecPerSecond, 1)
+}
+
+// Get the variance of throughput, as the variance over the stationary distribution of the instantaneous departure
+// rate (the service rate of the state), zero if not solved
+//   - approximation: fluctuations of the departure rate with the number in system, neglecting the randomness of
+//     departures at a given rate (Poisson), hence error bars on the throughput rather than on a count of departures
+func (m *MM1ModelStateDependent) GetThroughputVariance() float32 {
+	if !m.isValid {
+		return 0
+	}
+	num := len(m.servRate)
+	var second float64
+	for i := 1; i <= m.K; i++ {
+		mu := float64(m.servRate[min(i, num)-1])
+		second += m.p[i] * mu * mu
+	}
+	if m.unbounded {
+		mu := float64(m.servRate[num-1])
+		second += m.p[m.K] * m.tailRatio() / (1 - m.tailRatio()) * mu * mu
+	}
+	return float32(max(second-m.throughput*m.throughput, 0))
+}
+
+// Get a copy of the state-dependent service rates, servRate[n-1] is the service rate with n customers in service,
+// n=1,2,...,number of servers
+func (m *MM1ModelStateDependent) GetServiceRates() []float32 {
+	servRate := make([]float32, len(m.servRate))
+	copy(servRate, m.servRate)
+	return servRate
+}
+
+func (m *MM1ModelStateDependent) GetAvgNumInServers() float32 {
+	return float32(m.avgNumInServers)
+}
+
+// Get the average number of requests waiting in the queue (not yet in service),
+// sum over states above the number of servers of (state - servers) * p[state]
+func (m *MM1ModelStateDependent) GetAvgQueueLength() float32 {
+	return float32(m.avgQueueLength)
+}
+
+// Probability that an arrival finds the system full and is rejected (zero if queue is unbounded)
+func (m *MM1ModelStateDependent) GetBlockingProbability() float32 {
+	if m.unbounded {
+		return 0
+	}
+	return m.MM1KModel.GetBlockingProbability()
+}
+
+// Get a copy of the state probabilities, p[i] = Probability[system has exactly i customers], i=0,1,...,K
+//   - if the queue is unbounded, p[K+j] = p[K] * (lambda/servRate[K-1])^j, j=1,2,... are not included
+func (m *MM1ModelStateDependent) GetStateProbabilities() []float32 {
+	if !m.isValid {
+		return nil
+	}
+	probs := make([]float32, m.K+1)
+	for i, p := range m.p {
+		probs[i] = float32(p)
+	}
+	return probs
+}
+
+// Get probability that all servers are busy (system has at least as many customers as servers)
+func (m *MM1ModelStateDependent) GetProbBatchFull() float32 {
+	if !m.isValid {
+		return 0
+	}
+	var sum float64
+	for i := len(m.servRate); i <= m.K; i++ {
+		sum += m.p[i]
+	}
+	if m.unbounded {
+		sum += m.p[m.K] * m.tailRatio() / (1 - m.tailRatio())
+	}
+	return float32(sum)
+}
+
+// Get percentile of response time of admitted requests, p in (0, 1)
+//   - an arrival finding j >= c customers (c servers) waits for j-c+1 departures at the full service rate
+//   - service time is exponential with the average service time
+func (m *MM1ModelStateDependent) GetRespTimePercentile(p float32) float32 {
+	return m.GetScaledRespTimePercentile(p, 1)
+}
+
+// Get percentile of response time of admitted requests, p in (0, 1), with waiting time scaled by a factor
+func (m *MM1ModelStateDependent) GetScaledRespTimePercentile(p float32, waitScale float32) float32 {
+	return m.GetScaledRespTimePercentiles([]float32{p}, waitScale)[0]
+}
+
+// Get percentiles of response time of admitted requests, each p in (0, 1) (zero otherwise), with waiting time scaled
+// by a factor, all in a single march over a time grid (e.g. p95 and p99 for the cost of the larger one)
+func (m *MM1ModelStateDependent) GetScaledRespTimePercentiles(ps []float32, waitScale float32) []float32 {
+	percentiles := make([]float32, len(ps))
+	if !m.isValid || m.avgServTime <= 0 {
+		return percentiles
+	}
+	// indexes of valid ps in increasing order, reached in turn by the march
+	var order []int
+	for i, p := range ps {
+		if p > 0 && p < 1 {
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		return percentiles
+	}
+	slices.SortFunc(order, func(i, j int) int { return cmp.Compare(ps[i], ps[j]) })
+	scale := max(float64(waitScale), 0)
+	tailProb := m.waitPhasesTailProbabilities()
+
+	// march over a time grid, where the response time CDF C(t) satisfies
+	//   C(t+h) = exp(-nu*h) * C(t) + integral_t^{t+h} nu * exp(-nu*(t+h-x)) * W(x) dx
+	// W() is the waiting time CDF and nu is the service rate (trapezoid rule for the integral)
+	nu := 1 / m.avgServTime
+	h := (m.avgServTime + scale*m.avgWaitTime) / numStepsPerMean
+	decay := math.Exp(-nu * h)
+	var t, cdf float64
+	waitCDF := m.waitTimeCDF(0, scale, tailProb)
+	for range maxPercentileSteps {
+		nextWaitCDF := m.waitTimeCDF(t+h, scale, tailProb)
+		nextCDF := decay*cdf + 0.5*h*nu*(decay*waitCDF+nextWaitCDF)
+		for len(order) > 0 && nextCDF >= float64(ps[order[0]]) {
+			// interpolate within step
+			percentiles[order[0]] = float32(t + h*(float64(ps[order[0]])-cdf)/(nextCDF-cdf))
+			order = order[1:]
+		}
+		if len(order) == 0 {
+			return percentiles
+		}
+		t += h
+		cdf = nextCDF
+		waitCDF = nextWaitCDF
+	}
+	for _, i := range order {
+		percentiles[i] = float32(t)
+	}
+	return percentiles
+}
+
+// Get probability that the waiting time of an admitted request is at most x, with waiting time scaled by a factor
+func (m *MM1ModelStateDependent) GetScaledWaitTimeCDF(x float32, waitScale float32) float32 {
+	if !m.isValid {
+		return 0
+	}
+	if x < 0 {
+		return 0
+	}
+	return float32(m.waitTimeCDF(float64(x), max(float64(waitScale), 0), m.waitPhasesTailProbabilities()))
+}
+
+// CDF of waiting time at x, a mixture of Erlang distributions over the number of departures waited for
+//   - sum_k q[k] * ErlangCDF(k, mu, x) = 1 - sum_i Poisson(i; mu*x) * Q[i], where Q[i] = sum_{k>i} q[k]
+//   - only Poisson terms within a window around the mean are significant
+func (m *MM1ModelStateDependent) waitTimeCDF(x float64, waitScale float64, tailProb []float64) float64 {
+	if len(tailProb) == 0 || waitScale <= 0 {
+		return 1
+	}
+	num := len(m.servRate)
+	mean := float64(m.servRate[num-1]) * x / waitScale
+	if mean <= 0 {
+		return 1 - tailProb[0]
+	}
+	spread := poissonWindow*math.Sqrt(mean) + poissonWindow
+	first := int(max(mean-spread, 0))
+	last := min(int(mean+spread), len(tailProb)-1)
+	if first > last {
+		return 1
+	}
+	lg, _ := math.Lgamma(float64(first + 1))
+	poisson := math.Exp(-mean + float64(first)*math.Log(mean) - lg)
+	cdf := 1.0
+	for i := first; i <= last; i++ {
+		cdf -= poisson * tailProb[i]
+		poisson *= mean / float64(i+1)
+	}
+	return min(max(cdf, 0), 1)
+}
+
+// tail probabilities Q[i] = P[an admitted arrival waits for more than i departures]
+func (m *MM1ModelStateDependent) waitPhasesTailProbabilities() []float64 {
+	num := len(m.servRate)
+	if m.unbounded {
+		// Q[i] = P[arrival finds at least num+i customers] = p[num] * r^i / (1-r), truncated when negligible
+		r := m.tailRatio()
+		q := m.p[num] / (1 - r)
+		tailProb := []float64{}
+		for q > tailTruncation && len(tailProb) < maxPercentileSteps {
+			tailProb = append(tailProb, q)
+			q *= r
+		}
+		return tailProb
+	}
+	admitted := 1 - m.p[m.K]
+	if m.K <= num || admitted <= 0 {
+		return []float64{}
+	}
+	// an arrival finding j >= num customers waits for k = j-num+1 departures, j < K
+	tailProb := make([]float64, m.K-num)
+	var sum float64
+	for j := m.K - 1; j >= num; j-- {
+		sum += m.p[j] / admitted
+		tailProb[j-num] = sum
+	}
+	return tailProb
+}
+
+// Get diagnostics of the last solution of the model (state as last computed, even if invalid)
+func (m *MM1ModelStateDependent) Diagnostics() *Diagnostics {
+	sum := 0.0
+	for _, p := range m.p {
+		sum += p
+	}
+	if r := m.tailRatio(); m.unbounded && r < 1 {
+		sum += m.p[m.K] * r / (1 - r)
+	}
+	return &Diagnostics{
+		Valid:         m.isValid,
+		Lambda:        float32(m.lambda),
+		ServiceRates:  m.GetServiceRates(),
+		K:             m.K,
+		Unbounded:     m.unbounded,
+		LinearSolver:  m.linearSolver,
+		Probabilities: append([]float64(nil), m.p...),
+		SumResidual:   math.Abs(sum - 1),
+		Residual:      float32(m.residual),
+	}
+}
+
+// string of diagnostics, showing the first and last few elements of long vectors (service rates, probabilities)
+func (d *Diagnostics) String() string {
+	return fmt.Sprintf("{valid=%v, lambda=%v, K=%d, unbounded=%v, linearSolver=%v, sumResidual=%v, residual=%v, servRate=%s, p=%s}",
+		d.Valid, d.Lambda, d.K, d.Unbounded, d.LinearSolver, d.SumResidual, d.Residual,
+		vectorEnds(d.ServiceRates), vectorEnds(d.Probabilities))
+}
+
+// string of a vector, only its first and last few elements if long
+func vectorEnds[T float32 | float64](values []T) string {
+	if n := len(values); n > 2*diagnosticStates {
+		return fmt.Sprintf("%v ... %v", values[:diagnosticStates], values[n-diagnosticStates:])
+	}
+	return fmt.Sprintf("%v", values)
+}
+
+// encode the model, including its solved state (e.g. to cache a solved model), as a versioned gob
+func (m *MM1ModelStateDependent) MarshalBinary() ([]byte, error) {
+	state := modelState{
+		Version:         modelStateVersion,
+		K:               m.K,
+		ServiceRates:    m.servRate,
+		Unbounded:       m.unbounded,
+		LinearSolver:    m.linearSolver,
+		Valid:           m.isValid,
+		Lambda:          m.lambda,
+		Mu:              m.mu,
+		Rho:             m.rho,
+		AvgRespTime:     m.avgRespTime,
+		AvgWaitTime:     m.avgWaitTime,
+		AvgServTime:     m.avgServTime,
+		AvgNumInSystem:  m.avgNumInSystem,
+		AvgQueueLength:  m.avgQueueLength,
+		AvgNumInServers: m.avgNumInServers,
+		Residual:        m.residual,
+		Probabilities:   m.p,
+		SumP:            m.sumP,
+		Throughput:      m.throughput,
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&state); err != nil {
+		return nil, fmt.Errorf("failed to encode model: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// decode a model encoded by MarshalBinary, replacing the model
+//   - the version and shape (service rates, and probabilities of the occupancy bound) are checked, the model is left
+//     unchanged if invalid
+func (m *MM1ModelStateDependent) UnmarshalBinary(data []byte) error {
+	var state modelState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return fmt.Errorf("failed to decode model: %w", err)
+	}
+	if state.Version != modelStateVersion {
+		return fmt.Errorf("unsupported model version %d, expected %d", state.Version, modelStateVersion)
+	}
+	if num := len(state.ServiceRates); num == 0 || state.K < num || state.Unbounded && state.K != num {
+		return fmt.Errorf("model occupancy bound %d (unbounded=%v) inconsistent with %d service rates",
+			state.K, state.Unbounded, num)
+	}
+	if len(state.Probabilities) != state.K+1 {
+		return fmt.Errorf("model has %d state probabilities, expected %d for occupancy bound %d",
+			len(state.Probabilities), state.K+1, state.K)
+	}
+	m.init(state.K, state.ServiceRates)
+	m.unbounded = state.Unbounded
+	m.linearSolver = state.LinearSolver
+	m.isValid = state.Valid
+	m.lambda = state.Lambda
+	m.mu = state.Mu
+	m.rho = state.Rho
+	m.avgRespTime = state.AvgRespTime
+	m.avgWaitTime = state.AvgWaitTime
+	m.avgServTime = state.AvgServTime
+	m.avgNumInSystem = state.AvgNumInSystem
+	m.avgQueueLength = state.AvgQueueLength
+	m.avgNumInServers = state.AvgNumInServers
+	m.residual = state.Residual
+	m.p = state.Probabilities
+	m.sumP = state.SumP
+	m.throughput = state.Throughput
+	return nil
+}
+
+func (m *MM1ModelStateDependent) String() string {
+	var b bytes.Buffer
+	b.WriteString("MM1ModelStateDependent: ")
+	if m.unbounded {
+		b.WriteString("unbounded; ")
+	}
+	if m.linearSolver {
+		b.WriteString("linearSolver; ")
+	}
+	b.WriteString(m.MM1KModel.String())
+	return b.String()
+}
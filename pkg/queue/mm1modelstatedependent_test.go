@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// service rates (requests/msec) of an inference server for batch sizes 1, 2, ..., maxBatchSize, the batch size over
+// the service time of a request with linear prefill and decode times
+func testServiceRates(maxBatchSize int) []float32 {
+	const gamma, delta, alpha, beta = 86.615, 1.446e-03, 6.958, 0.042
+	const inputTokens, outputTokens = 128, 512
+	servRate := make([]float32, maxBatchSize)
+	for n := 1; n <= maxBatchSize; n++ {
+		b := float32(n)
+		servTime := gamma + delta*inputTokens*b + (outputTokens-1)*(alpha+beta*b)
+		servRate[n-1] = b / servTime
+	}
+	return servRate
+}
+
+// models of long chains near saturation (utilization of the max service rate about 0.99) are valid, with metrics
+// consistent by Little's law, by both solvers
+func TestSolveNearSaturation(t *testing.T) {
+	tests := []struct {
+		maxBatchSize int
+		maxQueueSize int
+		unbounded    bool
+	}{
+		{64, 100, false},
+		{256, 1024, false},
+		{1024, 1024, false},
+		{1024, 8192, false},
+		{256, 0, true},
+		{1024, 0, true},
+	}
+	for _, tt := range tests {
+		for _, linearSolver := range []bool{false, true} {
+			for _, rho := range []float32{0.98, 0.99, 0.995} {
+				name := fmt.Sprintf("batch %d queue %d unbounded %v linear %v rho %v",
+					tt.maxBatchSize, tt.maxQueueSize, tt.unbounded, linearSolver, rho)
+				t.Run(name, func(t *testing.T) {
+					servRate := testServiceRates(tt.maxBatchSize)
+					var m *MM1ModelStateDependent
+					if tt.unbounded {
+						m = NewMM1ModelStateDependentUnbounded(servRate)
+					} else {
+						m = NewMM1ModelStateDependent(tt.maxBatchSize+tt.maxQueueSize, servRate)
+					}
+					m.SetLinearSolver(linearSolver)
+					lambda := rho * servRate[tt.maxBatchSize-1]
+					if _, err := m.SolveChecked(lambda, 1); err != nil {
+						t.Fatalf("invalid model at lambda=%v: %v; %s", lambda, err, m.Diagnostics())
+					}
+					for name, value := range map[string]float32{"response time": m.GetAvgRespTime(),
+						"waiting time": m.GetAvgWaitTime(), "queue length": m.GetAvgQueueLength(),
+						"number in servers": m.GetAvgNumInServers(), "throughput": m.GetThroughput()} {
+						if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) || value < 0 {
+							t.Fatalf("invalid %s %v", name, value)
+						}
+					}
+					if n := m.GetAvgNumInServers(); n > float32(tt.maxBatchSize) || n < float32(tt.maxBatchSize)/2 {
+						t.Errorf("average number in servers %v near saturation, max batch size %d", n, tt.maxBatchSize)
+					}
+					throughput := float64(m.GetThroughput())
+					if diff := math.Abs(float64(m.GetAvgNumInSystem()) - throughput*float64(m.GetAvgRespTime())); diff > 1e-3*float64(m.GetAvgNumInSystem()) {
+						t.Errorf("average number in system %v, expected %v by Little's law",
+							m.GetAvgNumInSystem(), throughput*float64(m.GetAvgRespTime()))
+					}
+				})
+			}
+		}
+	}
+}
+
+// the consistency residual checks the state probabilities against the balance equations, so that a solution with a
+// perturbed probability is invalidated, while the solutions of both solvers are within tolerance
+func TestConsistencyResidual(t *testing.T) {
+	servRate := testServiceRates(64)
+	lambda := 0.9 * servRate[63]
+	for _, linearSolver := range []bool{false, true} {
+		t.Run(fmt.Sprintf("linear %v", linearSolver), func(t *testing.T) {
+			m := NewMM1ModelStateDependent(164, servRate)
+			m.SetLinearSolver(linearSolver)
+			result, err := m.SolveChecked(lambda, 1)
+			if err != nil {
+				t.Fatalf("invalid model at lambda=%v: %v; %s", lambda, err, m.Diagnostics())
+			}
+			if result.Residual != m.GetConsistencyResidual() || result.Residual > consistencyTolerance {
+				t.Fatalf("residual %v (result %v) above tolerance %v", m.GetConsistencyResidual(), result.Residual,
+					consistencyTolerance)
+			}
+
+			// perturb the probability of a waiting state by one percent, moving mass from its neighbor
+			n := 100
+			delta := 1e-2 * m.p[n]
+			m.p[n] += delta
+			m.p[n+1] -= delta
+			num := len(m.servRate)
+			serviceRate := func(n int) float64 { return float64(m.servRate[min(n, num)-1]) }
+			arrivalRate := func(int) float64 { return m.lambda }
+			m.checkConsistency(maxCutImbalance(m.p, m.K, arrivalRate, serviceRate), m.throughput, m.throughput)
+			if m.IsValid() || m.GetConsistencyResidual() <= consistencyTolerance {
+				t.Errorf("perturbed solution valid %v with residual %v", m.IsValid(), m.GetConsistencyResidual())
+			}
+		})
+	}
+}
+
+// solving models across occupancy sizes (max batch and queue sizes) at half the max service rate, by recurrence and by
+// the linear solver, to track the cost as batch and queue sizes grow (solving does not allocate)
+func BenchmarkSolve(b *testing.B) {
+	for _, size := range [][2]int{{8, 8}, {64, 64}, {256, 100}, {1024, 1024}} {
+		for _, linearSolver := range []bool{false, true} {
+			maxBatchSize, maxQueueSize := size[0], size[1]
+			name := fmt.Sprintf("maxBatch=%d/maxQueue=%d/linear=%v", maxBatchSize, maxQueueSize, linearSolver)
+			b.Run(name, func(b *testing.B) {
+				servRate := testServiceRates(maxBatchSize)
+				m := NewMM1ModelStateDependent(maxBatchSize+maxQueueSize, servRate)
+				m.SetLinearSolver(linearSolver)
+				lambda := servRate[maxBatchSize-1] / 2
+				m.Solve(lambda, 1) // allocates the work space of the linear solver, reused across solves
+				b.ReportAllocs()
+				b.ResetTimer()
+				for range b.N {
+					m.Solve(lambda, 1)
+				}
+				if !m.IsValid() {
+					b.Fatalf("invalid model: %s", m)
+				}
+			})
+		}
+	}
+}
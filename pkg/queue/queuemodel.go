@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// tolerance on the relative residual of the consistency identities of a valid solution
+const consistencyTolerance = 1e-6
+
+// error of an invalid solution of a queueing model, whose metrics are not to be used
+var ErrInvalidSolution = errors.New("invalid solution")
+
+// result of solving a queueing model (SolveChecked), so that an invalid solution is not mistaken for metrics
+type SolveResult struct {
+	Valid    bool    // input data valid, a stationary solution exists, and it satisfies the consistency identities
+	Residual float32 // largest relative residual of the consistency identities (zero if not solved)
+}
+
+// Basic Queueing Model (Abstract Class)
+//   - computed in float64 internally, rates and metrics are exposed as float32
+type QueueModel struct {
+	lambda float64 // arrival rate
+	mu     float64 // service rate
+	rho    float64 // utilization (average number of customers in service)
+
+	avgRespTime    float64 // average response time (waiting + service)
+	avgWaitTime    float64 // average waiting time
+	avgServTime    float64 // average service time
+	avgNumInSystem float64 // average total number of customers in system (waiting + in service)
+	avgQueueLength float64 // average queue length
+	isValid        bool    // validity of input data
+	residual       float64 // largest relative residual of the consistency identities of the solution
+
+	ComputeRho        func() float32 // compute utilization of queueing model
+	GetRhoMax         func() float32 // compute the maximum utilization of queueing model
+	computeStatistics func()         // evaluate performance measures of queueing model
+}
+
+// Solve queueing model given arrival and service rates
+func (m *QueueModel) Solve(lambda float32, mu float32) {
+	m.lambda = float64(lambda)
+	m.mu = float64(mu)
+	m.rho = float64(m.ComputeRho())
+	if (m.rho < 0) || (m.rho >= float64(m.GetRhoMax())) || (lambda < 0) || (mu <= 0) {
+		m.isValid = false
+	} else {
+		m.isValid = true
+		m.computeStatistics()
+	}
+}
+
+// result of the last solution of the model, with an error wrapping ErrInvalidSolution if invalid
+func (m *QueueModel) result() (*SolveResult, error) {
+	result := &SolveResult{Valid: m.isValid, Residual: float32(m.residual)}
+	switch {
+	case m.isValid:
+		return result, nil
+	case m.residual > consistencyTolerance:
+		return result, fmt.Errorf("%w: consistency residual %v above tolerance %v", ErrInvalidSolution, result.Residual, consistencyTolerance)
+	}
+	return result, fmt.Errorf("%w: invalid rates (lambda=%v, mu=%v), no stationary solution, or solver failure",
+		ErrInvalidSolution, m.GetLambda(), m.GetMu())
+}
+
+// Reset model to its unsolved state, clearing results of a previous solution
+func (m *QueueModel) Reset() {
+	m.lambda = 0
+	m.mu = 0
+	m.rho = 0
+	m.avgRespTime = 0
+	m.avgWaitTime = 0
+	m.avgServTime = 0
+	m.avgNumInSystem = 0
+	m.avgQueueLength = 0
+	m.isValid = false
+	m.residual = 0
+}
+
+// Copy solved state from another model
+func (m *QueueModel) copyState(other *QueueModel) {
+	m.lambda = other.lambda
+	m.mu = other.mu
+	m.rho = other.rho
+	m.avgRespTime = other.avgRespTime
+	m.avgWaitTime = other.avgWaitTime
+	m.avgServTime = other.avgServTime
+	m.avgNumInSystem = other.avgNumInSystem
+	m.avgQueueLength = other.avgQueueLength
+	m.isValid = other.isValid
+	m.residual = other.residual
+}
+
+// Check if the model is solved, with input data valid and a solution satisfying the consistency identities
+// (within a tolerance)
+func (m *QueueModel) IsValid() bool {
+	return m.isValid
+}
+
+// Get the largest relative residual of the consistency identities of the solution (zero if not solved), checking the
+// state probabilities against the balance equations of the model, relative to throughput:
+//   - cut balance between states n-1 and n, arrival flow p[n-1] * lambda(n-1) = departure flow p[n] * mu(n)
+//   - flow balance, departure rate from the states = throughput (rate of admitted arrivals)
+func (m *QueueModel) GetConsistencyResidual() float32 {
+	return float32(m.residual)
+}
+
+// set the residual of the consistency identities given the largest cut imbalance, departure rate, and throughput,
+// invalidating the model if above tolerance
+func (m *QueueModel) checkConsistency(cutImbalance float64, departureRate float64, throughput float64) {
+	residual := cutImbalance
+	if throughput > 0 {
+		residual = max(cutImbalance, math.Abs(departureRate-throughput)) / throughput
+	}
+	if math.IsNaN(residual) {
+		residual = math.Inf(1)
+	}
+	m.residual = residual
+	if residual > consistencyTolerance {
+		m.isValid = false
+	}
+}
+
+// largest imbalance of the flows between adjacent states 0, ..., top of the state probabilities p, given the arrival
+// rate in state n < top and the service rate in state n > 0
+func maxCutImbalance(p []float64, top int, arrivalRate func(n int) float64, serviceRate func(n int) float64) float64 {
+	var imbalance float64
+	for n := 1; n <= top; n++ {
+		diff := math.Abs(p[n-1]*arrivalRate(n-1) - p[n]*serviceRate(n))
+		if math.IsNaN(diff) {
+			return diff
+		}
+		imbalance = max(imbalance, diff)
+	}
+	return imbalance
+}
+
+func (m *QueueModel) GetLambda() float32 {
+	return float32(m.lambda)
+}
+
+func (m *QueueModel) GetMu() float32 {
+	return float32(m.mu)
+}
+
+func (m *QueueModel) GetRho() float32 {
+	return float32(m.rho)
+}
+
+func (m *QueueModel) GetAvgQueueLength() float32 {
+	return float32(m.avgQueueLength)
+}
+
+func (m *QueueModel) GetAvgNumInSystem() float32 {
+	return float32(m.avgNumInSystem)
+}
+
+func (m *QueueModel) GetAvgWaitTime() float32 {
+	return float32(m.avgWaitTime)
+}
+
+func (m *QueueModel) GetAvgServTime() float32 {
+	return float32(m.avgServTime)
+}
+
+func (m *QueueModel) GetAvgRespTime() float32 {
+	return float32(m.avgRespTime)
+}
+
+func (m *QueueModel) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "isValid=%v; ", m.isValid)
+	fmt.Fprintf(&b, "lambda=%v; mu=%v; rho=%v; ", m.GetLambda(), m.GetMu(), m.GetRho())
+	if m.residual > consistencyTolerance {
+		fmt.Fprintf(&b, "residual=%v; ", m.GetConsistencyResidual())
+	}
+	if m.isValid {
+		fmt.Fprintf(&b, "T=%v; W=%v; X=%v; ", m.GetAvgRespTime(), m.GetAvgWaitTime(), m.GetAvgServTime())
+		fmt.Fprintf(&b, "N=%v; Q=%v; ", m.GetAvgNumInSystem(), m.GetAvgQueueLength())
+	}
+	return b.String()
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+var epsilon float32 = 1e-6
+var maxIterations int = 100
+
+// fraction of the range initially bracketing a hint, and limit on the number of bracket expansions
+var hintWidthFraction float32 = 0.01
+var maxHintExpansions int = 8
+
+// A variable x is relatively within a given tolerance from a value
+func WithinTolerance(x, value, tolerance float32) bool {
+	if x == value {
+		return true
+	}
+	if value == 0 || tolerance < 0 {
+		return false
+	}
+	return math.Abs(float64((x-value)/value)) <= float64(tolerance)
+}
+
+// parameters of binary search
+type SearchParms struct {
+	Tolerance     float32 // relative tolerance of function value around the target
+	MaxIterations int     // maximum number of bisection iterations
+	// called with each point evaluated by the search and the function value (nil if not traced),
+	// e.g. to diagnose convergence or detect a non-monotonic function
+	Trace func(x float32, y float32)
+}
+
+// default parameters of binary search
+func DefaultSearchParms() *SearchParms {
+	return &SearchParms{
+		Tolerance:     epsilon,
+		MaxIterations: maxIterations,
+	}
+}
+
+// result of binary search
+type SearchResult struct {
+	XStar     float32 // point found
+	XLow      float32 // lower end of the last bracket containing the target
+	XHigh     float32 // upper end of the last bracket containing the target
+	Indicator int     // target is below (-1), within (0), or above (+1) the bounded region
+	Converged bool    // target found within tolerance, or bracket can no longer be narrowed (false if max iterations reached)
+}
+
+// Binary search: find xStar in a range [xMin, xMax] such that f(xStar)=yTarget.
+// Function f() must be monotonically increasing or decreasing over the range.
+// Returns an indicator of whether target is below (-1), within (0), or above (+1) the bounded region.
+// Returns an error if the function cannot be evaluated or the target is not found.
+func BinarySearch(xMin float32, xMax float32, yTarget float32,
+	eval func(float32) (float32, error)) (float32, int, error) {
+	r, err := BinarySearchWithParms(xMin, xMax, 0, yTarget, DefaultSearchParms(), eval)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.XStar, r.Indicator, nil
+}
+
+// Binary search with a hint: same as BinarySearch, starting with a narrow bracket around xHint,
+// which is expanded until it contains the target.
+// Falls back to the full range [xMin, xMax] if the hint is out of range or the target is not bracketed.
+func BinarySearchWithHint(xMin float32, xMax float32, xHint float32, yTarget float32,
+	eval func(float32) (float32, error)) (float32, int, error) {
+	r, err := BinarySearchWithParms(xMin, xMax, xHint, yTarget, DefaultSearchParms(), eval)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.XStar, r.Indicator, nil
+}
+
+// Binary search with search parameters: same as BinarySearchWithHint (no hint if xHint is out of range),
+// returning the last bracket and whether the search converged.
+// Reaching max iterations is not an error, the result is then flagged as not converged.
+func BinarySearchWithParms(xMin float32, xMax float32, xHint float32, yTarget float32,
+	parms *SearchParms, eval func(float32) (float32, error)) (*SearchResult, error) {
+
+	if xMin > xMax {
+		return nil, fmt.Errorf("invalid range [%v, %v]", xMin, xMax)
+	}
+	if parms.Tolerance < 0 || parms.MaxIterations < 1 {
+		return nil, fmt.Errorf("invalid search parameters: tolerance=%v, maxIterations=%d", parms.Tolerance, parms.MaxIterations)
+	}
+	if parms.Trace != nil {
+		eval = traced(eval, parms.Trace)
+	}
+	if xHint > xMin && xHint < xMax {
+		if r, err := searchAroundHint(xMin, xMax, xHint, yTarget, parms, eval); r != nil || err != nil {
+			return r, err
+		}
+	}
+
+	// evaluate the function at the boundaries
+	var yBounds []float32 = make([]float32, 2)
+	var err error
+	for i, x := range []float32{xMin, xMax} {
+		if yBounds[i], err = eval(x); err != nil {
+			return nil, fmt.Errorf("invalid function evaluation: %v", err)
+		}
+		if WithinTolerance(yBounds[i], yTarget, parms.Tolerance) {
+			return found(x), nil
+		}
+	}
+
+	increasing := yBounds[0] < yBounds[1]
+	if increasing && yTarget < yBounds[0] || !increasing && yTarget > yBounds[0] {
+		r := found(xMin) // target is below the bounded region
+		r.Indicator = -1
+		return r, nil
+	}
+	if increasing && yTarget > yBounds[1] || !increasing && yTarget < yBounds[1] {
+		r := found(xMax) // target is above the bounded region
+		r.Indicator = +1
+		return r, nil
+	}
+	return bisect(xMin, xMax, increasing, yTarget, parms, eval)
+}
+
+// search a narrow bracket around xHint, expanded until it contains the target
+//   - returns a nil result (and no error) if the target is not bracketed
+func searchAroundHint(xMin float32, xMax float32, xHint float32, yTarget float32,
+	parms *SearchParms, eval func(float32) (float32, error)) (*SearchResult, error) {
+
+	width := (xMax - xMin) * hintWidthFraction
+	for i := 0; i < maxHintExpansions; i++ {
+		xLow := max(xMin, xHint-width)
+		xHigh := min(xMax, xHint+width)
+		if xLow == xMin && xHigh == xMax {
+			break
+		}
+
+		// evaluate the function at the bracket boundaries
+		yLow, err := eval(xLow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function evaluation: %v", err)
+		}
+		if WithinTolerance(yLow, yTarget, parms.Tolerance) {
+			return found(xLow), nil
+		}
+		yHigh, err := eval(xHigh)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function evaluation: %v", err)
+		}
+		if WithinTolerance(yHigh, yTarget, parms.Tolerance) {
+			return found(xHigh), nil
+		}
+		if min(yLow, yHigh) < yTarget && yTarget < max(yLow, yHigh) {
+			return bisect(xLow, xHigh, yLow < yHigh, yTarget, parms, eval)
+		}
+		width *= 4
+	}
+	return nil, nil
+}
+
+// bisect a range [xMin, xMax] known to contain the target
+func bisect(xMin float32, xMax float32, increasing bool, yTarget float32,
+	parms *SearchParms, eval func(float32) (float32, error)) (*SearchResult, error) {
+
+	var xStar, yStar float32
+	var err error
+	for i := 0; i < parms.MaxIterations; i++ {
+		xStar = 0.5 * (xMin + xMax)
+		if xStar == xMin || xStar == xMax {
+			// bracket narrowed down to the precision of x
+			return &SearchResult{XStar: xStar, XLow: xMin, XHigh: xMax, Converged: true}, nil
+		}
+		if yStar, err = eval(xStar); err != nil {
+			return nil, fmt.Errorf("invalid function evaluation: %v", err)
+		}
+		if WithinTolerance(yStar, yTarget, parms.Tolerance) {
+			return &SearchResult{XStar: xStar, XLow: xMin, XHigh: xMax, Converged: true}, nil
+		}
+		if increasing && yTarget < yStar || !increasing && yTarget > yStar {
+			xMax = xStar
+		} else {
+			xMin = xStar
+		}
+	}
+	return &SearchResult{XStar: xStar, XLow: xMin, XHigh: xMax}, nil
+}
+
+// result of a search ending at a single point
+func found(x float32) *SearchResult {
+	return &SearchResult{XStar: x, XLow: x, XHigh: x, Converged: true}
+}
+
+// wrap function to report each successful evaluation
+func traced(eval func(float32) (float32, error), trace func(x float32, y float32)) func(float32) (float32, error) {
+	return func(x float32) (float32, error) {
+		y, err := eval(x)
+		if err == nil {
+			trace(x, y)
+		}
+		return y, err
+	}
+}